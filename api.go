@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/heyLu/lp/go/things/handler"
+	"github.com/heyLu/lp/go/things/storage"
+)
+
+// APIRoutes serves things as json, below /api/v1/{namespace}:
+//
+//	GET    /kinds                    all kinds
+//	GET    /things?kind=...&q=...    things, optionally of one kind and matching a query
+//	POST   /things                   create a thing
+//	GET    /things/{kind}/{id}       one thing
+//	PUT    /things/{kind}/{id}       update a thing, keeping what is not sent
+//	DELETE /things/{kind}/{id}       move a thing to the trash
+//	POST   /evaluate                 parse {"input": "...", "save": false} like the input box
+func (t *Things) APIRoutes(router chi.Router) {
+	router.Get("/kinds", t.HandleAPIKinds)
+	router.Get("/things", t.HandleAPIList)
+	router.Post("/things", t.HandleAPICreate)
+	router.Get("/things/{kind}/{id}", t.HandleAPIFind)
+	router.Put("/things/{kind}/{id}", t.HandleAPIUpdate)
+	router.Delete("/things/{kind}/{id}", t.HandleAPIDelete)
+	router.Post("/evaluate", t.HandleAPIEvaluate)
+}
+
+// APIThing is the json representation of a [storage.Row].
+type APIThing struct {
+	Namespace    string         `json:"namespace"`
+	Kind         string         `json:"kind"`
+	ID           int64          `json:"id,omitempty"`
+	Summary      *string        `json:"summary"`
+	Content      *string        `json:"content,omitempty"`
+	Ref          *string        `json:"ref,omitempty"`
+	Number       *int64         `json:"number,omitempty"`
+	Float        *float64       `json:"float,omitempty"`
+	Bool         *bool          `json:"bool,omitempty"`
+	Time         *time.Time     `json:"time,omitempty"`
+	Fields       map[string]any `json:"fields,omitempty"`
+	Tags         []string       `json:"tags,omitempty"`
+	DateCreated  *time.Time     `json:"date_created,omitempty"`
+	DateModified *time.Time     `json:"date_modified,omitempty"`
+}
+
+func toAPIThing(row *storage.Row) APIThing {
+	thing := APIThing{
+		Namespace: row.Namespace,
+		Kind:      row.Kind,
+		ID:        row.ID,
+		Summary:   &row.Summary,
+		Fields:    row.Fields,
+	}
+
+	if row.Content.Valid {
+		thing.Content = &row.Content.String
+	}
+	if row.Ref.Valid {
+		thing.Ref = &row.Ref.String
+	}
+	if row.Number.Valid {
+		thing.Number = &row.Number.Int64
+	}
+	if row.Float.Valid {
+		thing.Float = &row.Float.Float64
+	}
+	if row.Bool.Valid {
+		thing.Bool = &row.Bool.Bool
+	}
+	if row.Time.Valid {
+		thing.Time = &row.Time.Time
+	}
+
+	thing.Tags = slices.DeleteFunc(slices.Clone(row.Tags), func(tag string) bool { return tag == "" })
+
+	if !row.DateCreated.IsZero() {
+		thing.DateCreated = &row.DateCreated
+	}
+	if row.DateModified.Unix() > 0 {
+		thing.DateModified = &row.DateModified
+	}
+
+	return thing
+}
+
+func (at APIThing) toRow() *storage.Row {
+	row := &storage.Row{
+		Metadata: storage.Metadata{
+			Namespace: at.Namespace,
+			Kind:      at.Kind,
+			ID:        at.ID,
+			Tags:      at.Tags,
+		},
+		Fields: at.Fields,
+	}
+
+	if at.Summary != nil {
+		row.Summary = *at.Summary
+	}
+	if at.Content != nil {
+		row.Content = sql.NullString{String: *at.Content, Valid: true}
+	}
+	if at.Ref != nil {
+		row.Ref = sql.NullString{String: *at.Ref, Valid: true}
+	}
+	if at.Number != nil {
+		row.Number = sql.NullInt64{Int64: *at.Number, Valid: true}
+	}
+	if at.Float != nil {
+		row.Float = sql.NullFloat64{Float64: *at.Float, Valid: true}
+	}
+	if at.Bool != nil {
+		row.Bool = sql.NullBool{Bool: *at.Bool, Valid: true}
+	}
+	if at.Time != nil {
+		row.Time = sql.NullTime{Time: *at.Time, Valid: true}
+	}
+
+	return row
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		// too late to tell the client, the status is out already
+		return
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func storageErrorStatus(err error) int {
+	if errors.Is(err, storage.ErrNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func (t *Things) HandleAPIKinds(w http.ResponseWriter, req *http.Request) {
+	kinds := make([]string, 0, len(t.kinds))
+	for kind := range t.kinds {
+		kinds = append(kinds, kind)
+	}
+	slices.Sort(kinds)
+
+	writeJSON(w, http.StatusOK, kinds)
+}
+
+func (t *Things) HandleAPIList(w http.ResponseWriter, req *http.Request) {
+	namespace := req.Context().Value(NamespaceKey).(string)
+
+	terms, conditions, err := handler.ParseQuery(req.Context(), req.URL.Query().Get("q"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if kind := req.URL.Query().Get("kind"); kind != "" {
+		conditions = append(conditions, storage.Kind(kind))
+	}
+
+	rows, err := t.storage.Search(req.Context(), namespace, terms, conditions...)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	things := make([]APIThing, 0, 10)
+	for rows.Next() {
+		var row storage.Row
+		err := rows.Scan(&row)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+		things = append(things, toAPIThing(&row))
+	}
+
+	err = rows.Err()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, things)
+}
+
+func (t *Things) HandleAPIFind(w http.ResponseWriter, req *http.Request) {
+	row, err := t.storage.Find(req.Context(), chi.URLParam(req, "namespace"), chi.URLParam(req, "id"))
+	if err == nil && row.Kind != chi.URLParam(req, "kind") {
+		err = storage.ErrNotFound
+	}
+	if err != nil {
+		writeJSONError(w, storageErrorStatus(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toAPIThing(row))
+}
+
+func (t *Things) HandleAPICreate(w http.ResponseWriter, req *http.Request) {
+	var thing APIThing
+	err := json.NewDecoder(req.Body).Decode(&thing)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if !t.kinds[thing.Kind] {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("unknown kind %q", thing.Kind))
+		return
+	}
+	_, hndl := t.handlers.For(thing.Kind)
+
+	row := thing.toRow()
+	row.Namespace = chi.URLParam(req, "namespace")
+
+	err = handler.BeforeSave(req.Context(), t.storage, hndl, row)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = t.storage.Insert(req.Context(), row)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, toAPIThing(row))
+}
+
+func (t *Things) HandleAPIUpdate(w http.ResponseWriter, req *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(req, "id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var thing APIThing
+	err = json.NewDecoder(req.Body).Decode(&thing)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	row, err := t.storage.Find(req.Context(), chi.URLParam(req, "namespace"), id)
+	if err == nil && row.Kind != chi.URLParam(req, "kind") {
+		err = storage.ErrNotFound
+	}
+	if err != nil {
+		writeJSONError(w, storageErrorStatus(err), err)
+		return
+	}
+
+	// only change what was sent
+	changes := thing.toRow()
+	if thing.Summary != nil {
+		if *thing.Summary == "" {
+			writeJSONError(w, http.StatusBadRequest, errors.New("summary cannot be empty"))
+			return
+		}
+		row.Summary = changes.Summary
+	}
+	if thing.Content != nil {
+		row.Content = changes.Content
+	}
+	if thing.Ref != nil {
+		row.Ref = changes.Ref
+	}
+	if thing.Number != nil {
+		row.Number = changes.Number
+	}
+	if thing.Float != nil {
+		row.Float = changes.Float
+	}
+	if thing.Bool != nil {
+		row.Bool = changes.Bool
+	}
+	if thing.Time != nil {
+		row.Time = changes.Time
+	}
+	if thing.Fields != nil {
+		row.Fields = changes.Fields
+	}
+	if thing.Tags != nil {
+		row.Tags = thing.Tags
+	}
+
+	err = update(req.Context(), t.storage, row)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	updated, err := t.storage.Find(req.Context(), row.Namespace, row.ID)
+	if err != nil {
+		writeJSONError(w, storageErrorStatus(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toAPIThing(updated))
+}
+
+func (t *Things) HandleAPIDelete(w http.ResponseWriter, req *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(req, "id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = t.storage.Delete(req.Context(), chi.URLParam(req, "namespace"), chi.URLParam(req, "kind"), id)
+	if err != nil {
+		writeJSONError(w, storageErrorStatus(err), err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type apiEvaluation struct {
+	Input string `json:"input"`
+	Save  bool   `json:"save"`
+}
+
+type apiEvaluationResult struct {
+	Kind  string    `json:"kind"`
+	Thing *APIThing `json:"thing,omitempty"`
+	Saved bool      `json:"saved"`
+}
+
+// HandleAPIEvaluate parses the input like [Things.HandleThing] does, and
+// saves the result only if asked to.
+func (t *Things) HandleAPIEvaluate(w http.ResponseWriter, req *http.Request) {
+	var evaluation apiEvaluation
+	err := json.NewDecoder(req.Body).Decode(&evaluation)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	timeout := 1 * time.Second
+	if evaluation.Save {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	defer cancel()
+
+	hndl, row, err := t.evaluate(ctx, evaluation.Input)
+	if err != nil {
+		if err == ErrNotHandled {
+			writeJSONError(w, http.StatusUnprocessableEntity, errors.New("don't know what to do with that (yet)"))
+			return
+		}
+
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// previews include what is computed when saving, e.g. the result of math
+	err = handler.BeforeSave(ctx, t.storage, hndl, row)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if evaluation.Save {
+		err := t.storage.Insert(ctx, row)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	kind, _ := hndl.CanHandle("")
+	thing := toAPIThing(row)
+	writeJSON(w, http.StatusOK, apiEvaluationResult{
+		Kind:  kind,
+		Thing: &thing,
+		Saved: evaluation.Save,
+	})
+}
@@ -0,0 +1,330 @@
+// things-cli talks to things from the terminal, either through a server's
+// api or directly to a local database.
+//
+//	things-cli task fix the bike #errands          # preview
+//	things-cli -save task fix the bike #errands    # save
+//	things-cli -kinds                              # list kinds
+//	things-cli -db things.db -save note hi         # without a server
+//
+// The server, namespace and token default to $THINGS_SERVER,
+// $THINGS_NAMESPACE and $THINGS_TOKEN.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/heyLu/lp/go/things/handler"
+	"github.com/heyLu/lp/go/things/storage"
+)
+
+var settings struct {
+	Server    string
+	Namespace string
+	Token     string
+	DBPath    string
+
+	Save  bool
+	Kinds bool
+}
+
+func main() {
+	flag.StringVar(&settings.Server, "server", envOr("THINGS_SERVER", "http://localhost:5000"), "Server to talk to")
+	flag.StringVar(&settings.Namespace, "namespace", os.Getenv("THINGS_NAMESPACE"), "Namespace to use")
+	flag.StringVar(&settings.Token, "token", os.Getenv("THINGS_TOKEN"), "Token for the namespace, if it has one")
+	flag.StringVar(&settings.DBPath, "db", "", "Path to a db file to use directly instead of a server")
+	flag.BoolVar(&settings.Save, "save", false, "Save the thing instead of only previewing it")
+	flag.BoolVar(&settings.Kinds, "kinds", false, "List the kinds of things")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <input...>\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	err := run(context.Background())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+func envOr(key string, def string) string {
+	if val := os.Getenv(key); val != "" {
+		return val
+	}
+	return def
+}
+
+func run(ctx context.Context) error {
+	if settings.Namespace == "" {
+		return fmt.Errorf("-namespace or $THINGS_NAMESPACE is required")
+	}
+
+	var cl client
+	if settings.DBPath != "" {
+		db, err := storage.NewDBStorage(ctx, "file:"+settings.DBPath)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		cl = &localClient{storage: db, namespace: settings.Namespace}
+	} else {
+		cl = &remoteClient{
+			server:    strings.TrimSuffix(settings.Server, "/"),
+			namespace: settings.Namespace,
+			token:     settings.Token,
+			client:    &http.Client{Timeout: 10 * time.Second},
+		}
+	}
+
+	if settings.Kinds {
+		kinds, err := cl.Kinds(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, kind := range kinds {
+			fmt.Println(kind)
+		}
+		return nil
+	}
+
+	input := strings.Join(flag.Args(), " ")
+	if input == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	res, err := cl.Evaluate(ctx, input, settings.Save)
+	if err != nil {
+		return err
+	}
+
+	res.print(os.Stdout)
+	return nil
+}
+
+type client interface {
+	Evaluate(ctx context.Context, input string, save bool) (*result, error)
+	Kinds(ctx context.Context) ([]string, error)
+}
+
+// result is what the server's /evaluate returns.
+type result struct {
+	Kind  string `json:"kind"`
+	Thing *thing `json:"thing"`
+	Saved bool   `json:"saved"`
+}
+
+type thing struct {
+	Namespace string         `json:"namespace"`
+	Kind      string         `json:"kind"`
+	ID        int64          `json:"id"`
+	Summary   string         `json:"summary"`
+	Content   *string        `json:"content"`
+	Ref       *string        `json:"ref"`
+	Number    *int64         `json:"number"`
+	Float     *float64       `json:"float"`
+	Bool      *bool          `json:"bool"`
+	Time      *time.Time     `json:"time"`
+	Fields    map[string]any `json:"fields"`
+}
+
+func (r *result) print(w io.Writer) {
+	fmt.Fprintln(w, r.Kind)
+	if r.Thing == nil {
+		return
+	}
+
+	t := r.Thing
+	if t.Summary != "" {
+		fmt.Fprintf(w, "  summary: %s\n", strings.TrimSpace(t.Summary))
+	}
+	if t.Content != nil {
+		fmt.Fprintf(w, "  content: %s\n", *t.Content)
+	}
+	if t.Ref != nil {
+		fmt.Fprintf(w, "  ref:     %s\n", *t.Ref)
+	}
+	if t.Number != nil {
+		fmt.Fprintf(w, "  number:  %d\n", *t.Number)
+	}
+	if t.Float != nil {
+		fmt.Fprintf(w, "  float:   %g\n", *t.Float)
+	}
+	if t.Bool != nil {
+		fmt.Fprintf(w, "  bool:    %t\n", *t.Bool)
+	}
+	if t.Time != nil {
+		fmt.Fprintf(w, "  time:    %s (in %s)\n", t.Time.Local().Format("2006-01-02 15:04"), time.Until(*t.Time).Truncate(time.Minute))
+	}
+	keys := make([]string, 0, len(t.Fields))
+	for key := range t.Fields {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "  %s: %v\n", key, t.Fields[key])
+	}
+
+	if r.Saved {
+		fmt.Fprintf(w, "saved as %s/%s/%d\n", t.Namespace, t.Kind, t.ID)
+	}
+}
+
+type remoteClient struct {
+	server    string
+	namespace string
+	token     string
+	client    *http.Client
+}
+
+func (rc *remoteClient) do(ctx context.Context, method string, path string, body any, res any) error {
+	var reqBody io.Reader
+	if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(buf)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, rc.server+"/api/v1/"+url.PathEscape(rc.namespace)+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if rc.token != "" {
+		req.Header.Set("Authorization", "Bearer "+rc.token)
+	}
+
+	resp, err := rc.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		err := json.NewDecoder(resp.Body).Decode(&apiErr)
+		if err != nil || apiErr.Error == "" {
+			return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+		}
+		return fmt.Errorf("%s", apiErr.Error)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(res)
+}
+
+func (rc *remoteClient) Evaluate(ctx context.Context, input string, save bool) (*result, error) {
+	var res result
+	err := rc.do(ctx, http.MethodPost, "/evaluate", map[string]any{"input": input, "save": save}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (rc *remoteClient) Kinds(ctx context.Context) ([]string, error) {
+	var kinds []string
+	err := rc.do(ctx, http.MethodGet, "/kinds", nil, &kinds)
+	return kinds, err
+}
+
+// localClient parses input with the handlers directly, like the server does.
+type localClient struct {
+	storage   storage.Storage
+	namespace string
+}
+
+func (lc *localClient) Evaluate(ctx context.Context, input string, save bool) (*result, error) {
+	settings, err := handler.LoadSettings(ctx, lc.storage, lc.namespace)
+	if err != nil {
+		return nil, err
+	}
+	ctx = handler.WithSettings(ctx, settings)
+
+	for _, hndl := range handler.All {
+		kind, ok := hndl.CanHandle(input)
+		if !ok {
+			continue
+		}
+
+		parsed, err := hndl.Parse(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+
+		row := parsed.ToRow()
+		row.Namespace = lc.namespace
+
+		// previews include what is computed when saving, like the server's
+		err = handler.BeforeSave(ctx, lc.storage, hndl, row)
+		if err != nil {
+			return nil, err
+		}
+
+		if save {
+			err := lc.storage.Insert(ctx, row)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return &result{Kind: kind, Thing: toThing(row), Saved: save}, nil
+	}
+
+	return nil, fmt.Errorf("don't know what to do with that (yet)")
+}
+
+func (lc *localClient) Kinds(ctx context.Context) ([]string, error) {
+	kinds := make([]string, 0, len(handler.All))
+	for _, hndl := range handler.All {
+		kind, _ := hndl.CanHandle("")
+		kinds = append(kinds, kind)
+	}
+	slices.Sort(kinds)
+	return kinds, nil
+}
+
+func toThing(row *storage.Row) *thing {
+	t := &thing{
+		Namespace: row.Namespace,
+		Kind:      row.Kind,
+		ID:        row.ID,
+		Summary:   row.Summary,
+		Fields:    row.Fields,
+	}
+	if row.Content.Valid {
+		t.Content = &row.Content.String
+	}
+	if row.Ref.Valid {
+		t.Ref = &row.Ref.String
+	}
+	if row.Number.Valid {
+		t.Number = &row.Number.Int64
+	}
+	if row.Float.Valid {
+		t.Float = &row.Float.Float64
+	}
+	if row.Bool.Valid {
+		t.Bool = &row.Bool.Bool
+	}
+	if row.Time.Valid {
+		t.Time = &row.Time.Time
+	}
+	return t
+}
@@ -0,0 +1,349 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/heyLu/lp/go/things/storage"
+)
+
+var _ Handler = BookmarkHandler{}
+var _ BeforeSaver = BookmarkHandler{}
+
+// Fetcher does http requests, [http.Client] implements it.
+type Fetcher interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// defaultFetcher only connects to public addresses, so that bookmarks can't
+// be used to look into the network things runs in.  Redirects are dialed in
+// the same way, so they are checked as well.
+var defaultFetcher Fetcher = &http.Client{
+	Timeout: 5 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: publicOnly,
+		}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+	},
+}
+
+// publicOnly refuses connections to loopback, link-local, private and
+// unspecified addresses.  It is called after the name was resolved.
+func publicOnly(network string, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsPrivate() || ip.IsUnspecified() {
+		return fmt.Errorf("not fetching non-public address %s", ip)
+	}
+	return nil
+}
+
+// BookmarkHandler handles `bookmark <url> [note]`, fetching the title,
+// description and favicon of the page when saving.
+type BookmarkHandler struct {
+	// Fetcher fetches pages, defaults to an http.Client with a timeout
+	Fetcher Fetcher
+	// Snapshot stores the text of the page as well, to read it later
+	Snapshot bool
+}
+
+func (bh BookmarkHandler) CanHandle(input string) (string, bool) {
+	return "bookmark", strings.HasPrefix(input, "bookmark")
+}
+
+func (bh BookmarkHandler) Parse(ctx context.Context, input string) (Thing, error) {
+	bookmark := &Bookmark{
+		Row: &storage.Row{
+			Metadata: storage.Metadata{
+				Kind: "bookmark",
+			},
+		},
+	}
+
+	parts := strings.SplitN(input, " ", 3)
+	if len(parts) < 2 || parts[1] == "" {
+		return bookmark, nil
+	}
+
+	u, err := url.Parse(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" {
+		u, err = url.Parse("https://" + parts[1])
+		if err != nil {
+			return nil, err
+		}
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("can only bookmark http and https urls, not %q", u.Scheme)
+	}
+
+	bookmark.Ref = sql.NullString{String: u.String(), Valid: true}
+	bookmark.Summary = u.String()
+
+	if len(parts) > 2 && strings.TrimSpace(parts[2]) != "" {
+		bookmark.Summary = strings.TrimSpace(parts[2])
+		bookmark.Content = sql.NullString{String: bookmark.Summary, Valid: true}
+	}
+
+	return bookmark, nil
+}
+
+// BeforeSave fetches the page and stores what it found in the fields.
+//
+// Failing to fetch the page is not an error, the bookmark is saved with what
+// we know.
+func (bh BookmarkHandler) BeforeSave(ctx context.Context, db storage.Storage, row *storage.Row) error {
+	if !row.Ref.Valid {
+		return fmt.Errorf("usage: bookmark <url> [note]")
+	}
+
+	fetcher := bh.Fetcher
+	if fetcher == nil {
+		fetcher = defaultFetcher
+	}
+
+	if row.Fields == nil {
+		row.Fields = make(map[string]any, 4)
+	}
+
+	page, err := fetchPage(ctx, fetcher, row.Ref.String)
+	if err != nil {
+		row.Fields["error"] = err.Error()
+		return nil
+	}
+
+	if page.title != "" {
+		row.Fields["title"] = page.title
+		if !row.Content.Valid {
+			row.Summary = page.title
+		}
+	}
+	if page.description != "" {
+		row.Fields["description"] = page.description
+	}
+	if page.favicon != "" {
+		row.Fields["favicon"] = page.favicon
+	}
+	if bh.Snapshot && page.text != "" {
+		row.Fields["snapshot"] = page.text
+	}
+
+	return nil
+}
+
+func (bh BookmarkHandler) Query(ctx context.Context, db storage.Storage, namespace string, input string) (storage.Rows, error) {
+	// not searching for the url that is being typed in, use `search kind:bookmark` for that
+	return db.Query(ctx, namespace, storage.Kind("bookmark"))
+}
+
+func (bh BookmarkHandler) Render(ctx context.Context, row *storage.Row) (Renderer, error) {
+	return TemplateRenderer{Template: bookmarkTemplate, Data: &Bookmark{Row: row}}, nil
+}
+
+type Bookmark struct {
+	*storage.Row
+}
+
+func (b *Bookmark) ToRow() *storage.Row { return b.Row }
+
+func (b *Bookmark) field(key string) string {
+	val, _ := b.Fields[key].(string)
+	return val
+}
+
+func (b *Bookmark) Title() string {
+	if title := b.field("title"); title != "" {
+		return title
+	}
+	return b.Ref.String
+}
+
+func (b *Bookmark) Description() string { return b.field("description") }
+func (b *Bookmark) Favicon() string     { return b.field("favicon") }
+func (b *Bookmark) Snapshot() string    { return b.field("snapshot") }
+
+func (b *Bookmark) Note() string {
+	if b.Content.Valid {
+		return b.Content.String
+	}
+	return ""
+}
+
+var bookmarkTemplate = template.Must(template.Must(commonTemplates.Clone()).Parse(`
+{{ define "content" }}
+<div class="bookmark-card">
+	<a href="{{ .Ref.String }}">
+		{{ if .Favicon }}<img class="favicon" src="{{ .Favicon }}" alt="" width="16" height="16" />{{ end }}
+		<strong>{{ .Title }}</strong>
+	</a>
+	<div class="url">{{ .Ref.String }}</div>
+	{{ if .Description }}<p class="description">{{ .Description }}</p>{{ end }}
+	{{ if .Note }}{{ markdown .Note }}{{ end }}
+	{{ if .Snapshot }}
+	<details>
+		<summary>snapshot</summary>
+		<pre>{{ .Snapshot }}</pre>
+	</details>
+	{{ end }}
+</div>
+{{ end }}
+`))
+
+type page struct {
+	title       string
+	description string
+	favicon     string
+	text        string
+}
+
+const maxPageSize = 2 * 1024 * 1024
+
+var (
+	titleRe   = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	metaRe    = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	linkRe    = regexp.MustCompile(`(?is)<link\s[^>]*>`)
+	attrRe    = regexp.MustCompile(`(?is)([a-z][a-z0-9:_-]*)\s*=\s*("[^"]*"|'[^']*'|[^\s>]+)`)
+	skipRe    = regexp.MustCompile(`(?is)<(script|style|noscript|svg|head)[^>]*>.*?</(script|style|noscript|svg|head)>`)
+	blockRe   = regexp.MustCompile(`(?i)</?(p|div|br|h[1-6]|li|tr|section|article|header|footer|pre|blockquote)[^>]*>`)
+	tagRe     = regexp.MustCompile(`(?s)<[^>]*>`)
+	spacesRe  = regexp.MustCompile(`[ \t\r\f\v]+`)
+	newlineRe = regexp.MustCompile(`\n\s*\n+`)
+)
+
+func fetchPage(ctx context.Context, fetcher Fetcher, pageURL string) (*page, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "things (bookmark)")
+
+	resp, err := fetcher.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("fetching %s: %s", pageURL, resp.Status)
+	}
+
+	base := resp.Request.URL
+	if base == nil {
+		base, _ = url.Parse(pageURL)
+	}
+
+	p := &page{favicon: resolveURL(base, "/favicon.ico")}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "" && mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return p, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil {
+		return nil, err
+	}
+	doc := string(body)
+
+	if m := titleRe.FindStringSubmatch(doc); m != nil {
+		p.title = cleanText(m[1])
+	}
+
+	for _, tag := range metaRe.FindAllString(doc, -1) {
+		attrs := parseAttrs(tag)
+		name := strings.ToLower(attrs["name"] + attrs["property"])
+		switch name {
+		case "description":
+			p.description = cleanText(attrs["content"])
+		case "og:description":
+			if p.description == "" {
+				p.description = cleanText(attrs["content"])
+			}
+		case "og:title":
+			if p.title == "" {
+				p.title = cleanText(attrs["content"])
+			}
+		}
+	}
+
+	for _, tag := range linkRe.FindAllString(doc, -1) {
+		attrs := parseAttrs(tag)
+		for _, rel := range strings.Fields(strings.ToLower(attrs["rel"])) {
+			if rel == "icon" && resolveURL(base, attrs["href"]) != "" {
+				p.favicon = resolveURL(base, attrs["href"])
+			}
+		}
+	}
+
+	p.text = readableText(doc)
+
+	return p, nil
+}
+
+func parseAttrs(tag string) map[string]string {
+	attrs := make(map[string]string, 4)
+	for _, m := range attrRe.FindAllStringSubmatch(tag, -1) {
+		val := m[2]
+		if len(val) >= 2 && (val[0] == '"' || val[0] == '\'') {
+			val = val[1 : len(val)-1]
+		}
+		attrs[strings.ToLower(m[1])] = html.UnescapeString(val)
+	}
+	return attrs
+}
+
+func resolveURL(base *url.URL, ref string) string {
+	u, err := base.Parse(ref)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return u.String()
+}
+
+func cleanText(s string) string {
+	return strings.TrimSpace(spacesRe.ReplaceAllString(strings.ReplaceAll(html.UnescapeString(s), "\n", " "), " "))
+}
+
+// readableText returns the text of an html page, without markup, scripts
+// and styles.
+func readableText(doc string) string {
+	doc = skipRe.ReplaceAllString(doc, "")
+	doc = blockRe.ReplaceAllString(doc, "\n")
+	doc = tagRe.ReplaceAllString(doc, "")
+	doc = html.UnescapeString(doc)
+	doc = spacesRe.ReplaceAllString(doc, " ")
+
+	lines := strings.Split(doc, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	doc = newlineRe.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+
+	return strings.TrimSpace(doc)
+}
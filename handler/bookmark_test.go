@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBookmark(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><head>
+<title>A  page &amp; more</title>
+<meta name="description" content="What it is about">
+<link rel="shortcut icon" href="/icon.png">
+<style>body { color: red; }</style>
+</head><body><h1>Hello</h1><p>Some <b>text</b>.</p><script>alert(1)</script></body></html>`))
+	}))
+	defer server.Close()
+
+	bh := BookmarkHandler{Fetcher: server.Client(), Snapshot: true}
+
+	thing, err := bh.Parse(context.Background(), "bookmark "+server.URL+"/page")
+	require.NoError(t, err)
+
+	row := thing.ToRow()
+	require.Equal(t, server.URL+"/page", row.Ref.String)
+
+	err = bh.BeforeSave(context.Background(), nil, row)
+	require.NoError(t, err)
+
+	require.Equal(t, "A page & more", row.Summary)
+	require.Equal(t, "A page & more", row.Fields["title"])
+	require.Equal(t, "What it is about", row.Fields["description"])
+	require.Equal(t, server.URL+"/icon.png", row.Fields["favicon"])
+	require.Equal(t, "Hello\n\nSome text.", row.Fields["snapshot"])
+
+	thing, err = bh.Parse(context.Background(), "bookmark "+server.URL+" read this later")
+	require.NoError(t, err)
+
+	row = thing.ToRow()
+	err = bh.BeforeSave(context.Background(), nil, row)
+	require.NoError(t, err)
+	require.Equal(t, "read this later", row.Summary)
+
+	_, err = bh.Parse(context.Background(), "bookmark ftp://example.com")
+	require.Error(t, err)
+
+	// only public addresses are fetched by default
+	bh = BookmarkHandler{}
+	thing, err = bh.Parse(context.Background(), "bookmark "+server.URL)
+	require.NoError(t, err)
+	row = thing.ToRow()
+	require.NoError(t, bh.BeforeSave(context.Background(), nil, row))
+	require.Contains(t, row.Fields["error"], "non-public address 127.0.0.1")
+
+	for _, address := range []string{"[::1]:80", "10.0.0.1:80", "169.254.169.254:80", "0.0.0.0:80", "[::ffff:192.168.1.1]:443"} {
+		require.Error(t, publicOnly("tcp", address, nil), address)
+	}
+	require.NoError(t, publicOnly("tcp", "93.184.215.14:443", nil))
+}
@@ -10,6 +10,7 @@ import (
 )
 
 var _ Handler = ByDateHandler{}
+var _ Summarizer = ByDateHandler{}
 
 type ByDateHandler struct{}
 
@@ -26,10 +27,10 @@ func (_ ByDateHandler) CanHandle(input string) (string, bool) {
 	return "by-date", byDateRe.MatchString(input)
 }
 
-func (_ ByDateHandler) Parse(input string) (Thing, error) {
+func (_ ByDateHandler) Parse(ctx context.Context, input string) (Thing, error) {
 	// TODO: support '<from> to <to>' syntax for custom ranges
 	for i, format := range byDateFormats {
-		t, err := time.Parse(format, input)
+		t, err := time.ParseInLocation(format, input, Location(ctx))
 		if err != nil {
 			continue
 		}
@@ -57,20 +58,46 @@ func (_ ByDateHandler) Parse(input string) (Thing, error) {
 	return nil, fmt.Errorf("can't parse %q", input)
 }
 
+// Query lists the things of a day.  Months and years are shown as a
+// calendar instead, see [ByDateHandler.Summarize].
 func (bdh ByDateHandler) Query(ctx context.Context, db storage.Storage, namespace string, input string) (storage.Rows, error) {
-	thing, err := bdh.Parse(input)
+	thing, err := bdh.Parse(ctx, input)
 	if err != nil {
 		return nil, err
 	}
 
 	byDate := thing.(*ByDate)
 
+	if byDate.calendar() {
+		return &sliceRows{}, nil
+	}
+
 	return db.Query(ctx, namespace,
-		storage.Gt("date_created", byDate.from.UTC().Unix()),
-		storage.Lt("date_created", byDate.to.UTC().Unix()),
+		storage.Ge("date_created", byDate.from.Unix()),
+		storage.Lt("date_created", byDate.to.Unix()),
 	)
 }
 
+// Summarize shows the calendar of a month or year.
+func (bdh ByDateHandler) Summarize(ctx context.Context, db storage.Storage, namespace string, input string) (Renderer, error) {
+	thing, err := bdh.Parse(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	byDate := thing.(*ByDate)
+
+	if !byDate.calendar() {
+		return nil, nil
+	}
+
+	calendar, err := loadCalendar(ctx, db, namespace, byDate)
+	if err != nil {
+		return nil, err
+	}
+	return TemplateRenderer{Template: calendarTemplate, Data: calendar}, nil
+}
+
 func (_ ByDateHandler) Render(ctx context.Context, row *storage.Row) (Renderer, error) {
 	if row.Kind == "overview" || row.Kind == "search" || row.Kind == "by-date" {
 		return StringRenderer(row.Kind + " " + row.Summary), nil
@@ -89,6 +116,11 @@ type ByDate struct {
 	to    time.Time
 }
 
+// calendar is true for months and years.
+func (bd ByDate) calendar() bool {
+	return len(bd.input) < len("2006-01-02")
+}
+
 func (bd ByDate) ToRow() *storage.Row {
 	return &storage.Row{
 		Metadata: storage.Metadata{
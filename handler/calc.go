@@ -0,0 +1,738 @@
+package handler
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Calculate evaluates math expressions like `2**10`, `sqrt(2) * 3`,
+// `120 + 15%`, `20% of 80`, `3km + 500m` or `100km / 2h to mph`.
+//
+// Values can have units, which are kept track of and can be converted to
+// other units of the same dimension with `to` or `in`.  Currencies like
+// `30 usd to eur` are converted using the rates in settings, and variables
+// are the `var.<name>` settings, see [LoadSettings].
+func Calculate(expr string, settings Settings) (string, error) {
+	q, err := calculate(expr, settings, currencies(settings.Rates()))
+	if err != nil {
+		return "", err
+	}
+	return q.String(), nil
+}
+
+func calculate(expr string, settings Settings, currencies map[string]currency) (quantity, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return quantity{}, err
+	}
+
+	p := &calcParser{input: expr, tokens: tokens, currencies: currencies, variables: settings}
+	return p.parse()
+}
+
+// dimension indexes
+const (
+	dimLength = iota
+	dimMass
+	dimTime
+	dimData
+	dimCurrency
+	numDims
+)
+
+var dimNames = [numDims]string{"m", "kg", "s", "B", "¤"}
+
+type dims [numDims]int
+
+type calcUnit struct {
+	factor float64
+	dims   dims
+}
+
+// displayUnit is the unit a quantity is shown in, e.g. km for 3500m.
+type displayUnit struct {
+	name   string
+	factor float64
+}
+
+var (
+	lengthDims = dims{dimLength: 1}
+	massDims   = dims{dimMass: 1}
+	periodDims = dims{dimTime: 1}
+	dataDims   = dims{dimData: 1}
+	volumeDims = dims{dimLength: 3}
+	speedDims  = dims{dimLength: 1, dimTime: -1}
+
+	currencyDims = dims{dimCurrency: 1}
+)
+
+var calcUnits = map[string]calcUnit{
+	"mm": {0.001, lengthDims}, "cm": {0.01, lengthDims}, "m": {1, lengthDims}, "km": {1000, lengthDims},
+	"meter": {1, lengthDims}, "meters": {1, lengthDims},
+	"inch": {0.0254, lengthDims}, "inches": {0.0254, lengthDims},
+	"ft": {0.3048, lengthDims}, "foot": {0.3048, lengthDims}, "feet": {0.3048, lengthDims},
+	"yd": {0.9144, lengthDims}, "mi": {1609.344, lengthDims}, "mile": {1609.344, lengthDims}, "miles": {1609.344, lengthDims},
+
+	"mg": {0.000001, massDims}, "g": {0.001, massDims}, "kg": {1, massDims}, "t": {1000, massDims},
+	"gram": {0.001, massDims}, "grams": {0.001, massDims},
+	"lb": {0.45359237, massDims}, "lbs": {0.45359237, massDims}, "oz": {0.028349523125, massDims},
+
+	"ms": {0.001, periodDims}, "s": {1, periodDims}, "sec": {1, periodDims}, "second": {1, periodDims}, "seconds": {1, periodDims},
+	"min": {60, periodDims}, "minute": {60, periodDims}, "minutes": {60, periodDims},
+	"h": {3600, periodDims}, "hr": {3600, periodDims}, "hour": {3600, periodDims}, "hours": {3600, periodDims},
+	"d": {86400, periodDims}, "day": {86400, periodDims}, "days": {86400, periodDims},
+	"week": {604800, periodDims}, "weeks": {604800, periodDims},
+	"month": {2629746, periodDims}, "months": {2629746, periodDims},
+	"year": {31556952, periodDims}, "years": {31556952, periodDims},
+
+	"bit": {0.125, dataDims}, "B": {1, dataDims}, "byte": {1, dataDims}, "bytes": {1, dataDims},
+	"KB": {1e3, dataDims}, "MB": {1e6, dataDims}, "GB": {1e9, dataDims}, "TB": {1e12, dataDims},
+	"KiB": {1 << 10, dataDims}, "MiB": {1 << 20, dataDims}, "GiB": {1 << 30, dataDims}, "TiB": {1 << 40, dataDims},
+
+	"ml": {0.000001, volumeDims}, "cl": {0.00001, volumeDims}, "l": {0.001, volumeDims}, "L": {0.001, volumeDims},
+	"gal": {0.003785411784, volumeDims},
+
+	"kph": {1000.0 / 3600, speedDims}, "kmh": {1000.0 / 3600, speedDims}, "mph": {1609.344 / 3600, speedDims},
+}
+
+var calcConstants = map[string]float64{
+	"pi": math.Pi,
+	"e":  math.E,
+}
+
+var calcFuncs = map[string]func(x float64) float64{
+	"sqrt": math.Sqrt, "cbrt": math.Cbrt, "exp": math.Exp,
+	"ln": math.Log, "log": math.Log10, "log2": math.Log2,
+	"sin": math.Sin, "cos": math.Cos, "tan": math.Tan,
+	"asin": math.Asin, "acos": math.Acos, "atan": math.Atan,
+}
+
+// functions that keep the unit of their argument, rounding in the unit the
+// value is shown in
+var calcRoundFuncs = map[string]func(x float64) float64{
+	"abs": math.Abs, "round": math.Round, "floor": math.Floor, "ceil": math.Ceil,
+}
+
+// quantity is a value in base units, e.g. 3500 with length for 3.5km.
+type quantity struct {
+	value   float64
+	dims    dims
+	unit    *displayUnit
+	percent bool
+
+	// rateDate is the date of the oldest exchange rate used
+	rateDate time.Time
+}
+
+func (q quantity) String() string {
+	if q.percent {
+		return formatCalcNumber(q.value*100) + "%"
+	}
+
+	if q.unit != nil && q.dims == currencyDims {
+		s := strconv.FormatFloat(q.value/q.unit.factor, 'f', 2, 64) + " " + q.unit.name
+		if !q.rateDate.IsZero() {
+			s += " (rate of " + q.rateDate.Format(rateDateFormat) + ")"
+		}
+		return s
+	}
+
+	if q.unit != nil {
+		return formatCalcNumber(q.value/q.unit.factor) + " " + q.unit.name
+	}
+
+	if q.dims == (dims{}) {
+		return formatCalcNumber(q.value)
+	}
+
+	return formatCalcNumber(q.value) + " " + q.dims.String()
+}
+
+// expr formats q so that it can be calculated again, without losing
+// precision like [quantity.String] does for currencies.
+func (q quantity) expr() string {
+	switch {
+	case q.percent:
+		return formatCalcNumber(q.value*100) + "%"
+	case q.unit != nil:
+		return formatCalcNumber(q.value/q.unit.factor) + " " + q.unit.name
+	case q.dims != (dims{}):
+		return formatCalcNumber(q.value) + " " + q.dims.String()
+	}
+	return formatCalcNumber(q.value)
+}
+
+func (d dims) String() string {
+	var num, den []string
+	for i, n := range d {
+		name := dimNames[i]
+		if n > 1 || n < -1 {
+			name += "^" + strconv.Itoa(max(n, -n))
+		}
+		if n > 0 {
+			num = append(num, name)
+		} else if n < 0 {
+			den = append(den, name)
+		}
+	}
+
+	s := strings.Join(num, "*")
+	if s == "" {
+		s = "1"
+	}
+	if len(den) > 0 {
+		s += "/" + strings.Join(den, "/")
+	}
+	return s
+}
+
+// formatCalcNumber formats f with at most 15 significant digits, so that
+// 0.1+0.2 is 0.3.
+func formatCalcNumber(f float64) string {
+	if f == 0 {
+		return "0"
+	}
+	if math.Abs(f) >= 1e21 || math.Abs(f) < 1e-9 {
+		return strconv.FormatFloat(f, 'g', 15, 64)
+	}
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(f, 'g', 15, 64), 64)
+	return strconv.FormatFloat(rounded, 'f', -1, 64)
+}
+
+type tokenKind int
+
+const (
+	tokenNumber tokenKind = iota
+	tokenIdent
+	tokenOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	num  float64
+	pos  int
+}
+
+func tokenize(input string) ([]token, error) {
+	tokens := make([]token, 0, 8)
+
+	isDigit := func(i int) bool { return i < len(input) && input[i] >= '0' && input[i] <= '9' }
+
+	for i := 0; i < len(input); {
+		r, size := utf8.DecodeRuneInString(input[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case isDigit(i) || (r == '.' && isDigit(i+1)):
+			start := i
+			for isDigit(i) || (i < len(input) && (input[i] == '.' || input[i] == '_')) {
+				i++
+			}
+			// exponents, but not e.g. `2eur`
+			if i < len(input) && (input[i] == 'e' || input[i] == 'E') {
+				j := i + 1
+				if j < len(input) && (input[j] == '-' || input[j] == '+') {
+					j++
+				}
+				if isDigit(j) {
+					for i = j; isDigit(i); i++ {
+					}
+				}
+			}
+			num, err := strconv.ParseFloat(strings.ReplaceAll(input[start:i], "_", ""), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q", input[start:i])
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: input[start:i], num: num, pos: start})
+		case unicode.IsLetter(r):
+			start := i
+			for i < len(input) {
+				r, size := utf8.DecodeRuneInString(input[i:])
+				if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				i += size
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: input[start:i], pos: start})
+		default:
+			op, ok := calcOp(input[i:])
+			if !ok {
+				return nil, fmt.Errorf("unexpected %q", string(r))
+			}
+			tokens = append(tokens, token{kind: tokenOp, text: calcOpAliases[op], pos: i})
+			i += len(op)
+		}
+	}
+
+	return tokens, nil
+}
+
+var calcOpAliases = map[string]string{
+	"**": "**", "^": "**",
+	"*": "*", "×": "*",
+	"/": "/", "÷": "/",
+	"+": "+", "-": "-", "%": "%", "(": "(", ")": ")", ",": ",",
+}
+
+func calcOp(s string) (string, bool) {
+	if strings.HasPrefix(s, "**") {
+		return "**", true
+	}
+	for op := range calcOpAliases {
+		if op != "**" && strings.HasPrefix(s, op) {
+			return op, true
+		}
+	}
+	return "", false
+}
+
+var calcKeywords = map[string]bool{"to": true, "in": true, "as": true, "of": true, "mod": true}
+
+// isCalcName returns true if name is already used by the calculator, so that
+// it cannot be the name of a variable.
+func isCalcName(name string) bool {
+	_, isUnit := calcUnits[name]
+	_, isConstant := calcConstants[name]
+	_, isFunc := calcFuncs[name]
+	_, isRoundFunc := calcRoundFuncs[name]
+	return isUnit || isConstant || isFunc || isRoundFunc || calcKeywords[name] || isCurrency(name) || name == "min" || name == "max"
+}
+
+type calcParser struct {
+	input      string
+	tokens     []token
+	pos        int
+	currencies map[string]currency
+	variables  Settings
+}
+
+func (p *calcParser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *calcParser) isOp(op string) bool {
+	t, ok := p.peek()
+	return ok && t.kind == tokenOp && t.text == op
+}
+
+func (p *calcParser) isIdent(name string) bool {
+	t, ok := p.peek()
+	return ok && t.kind == tokenIdent && t.text == name
+}
+
+func (p *calcParser) parse() (quantity, error) {
+	if len(p.tokens) == 0 {
+		return quantity{}, fmt.Errorf("nothing to calculate")
+	}
+
+	q, err := p.sum()
+	if err != nil {
+		return q, err
+	}
+
+	if p.isIdent("to") || p.isIdent("in") || p.isIdent("as") {
+		p.pos++
+		t, ok := p.peek()
+		if !ok {
+			return q, fmt.Errorf("convert to what?")
+		}
+
+		if p.isOp("%") && p.pos == len(p.tokens)-1 {
+			if q.dims != (dims{}) {
+				return q, fmt.Errorf("can't convert %s to %%", q)
+			}
+			q.percent = true
+			return q, nil
+		}
+
+		target, err := p.sum()
+		if err != nil {
+			return q, err
+		}
+		if target.dims != q.dims {
+			return q, fmt.Errorf("can't convert %s to %s", q, strings.TrimSpace(p.input[t.pos:]))
+		}
+
+		q.unit = &displayUnit{name: strings.TrimSpace(p.input[t.pos:]), factor: target.value}
+		q.rateDate = older(q.rateDate, target.rateDate)
+		if q.dims == (dims{}) {
+			q.unit = nil
+			q.percent = target.percent
+		}
+	}
+
+	if t, ok := p.peek(); ok {
+		return q, fmt.Errorf("unexpected %q", t.text)
+	}
+
+	return q, nil
+}
+
+func (p *calcParser) sum() (quantity, error) {
+	left, err := p.product()
+	if err != nil {
+		return left, err
+	}
+
+	for p.isOp("+") || p.isOp("-") {
+		op := p.tokens[p.pos].text
+		p.pos++
+
+		right, err := p.product()
+		if err != nil {
+			return left, err
+		}
+
+		// 100 + 10% is 110
+		if right.percent && !left.percent {
+			if op == "-" {
+				right.value = -right.value
+			}
+			left.value *= 1 + right.value
+			left.rateDate = older(left.rateDate, right.rateDate)
+			continue
+		}
+
+		if left.dims != right.dims {
+			return left, fmt.Errorf("can't %s %s and %s", map[string]string{"+": "add", "-": "subtract"}[op], left, right)
+		}
+
+		if op == "-" {
+			right.value = -right.value
+		}
+		left.value += right.value
+		left.rateDate = older(left.rateDate, right.rateDate)
+		if left.unit == nil {
+			left.unit = right.unit
+		}
+	}
+
+	return left, nil
+}
+
+func (p *calcParser) product() (quantity, error) {
+	left, err := p.unary()
+	if err != nil {
+		return left, err
+	}
+
+	for {
+		var op string
+		switch {
+		case p.isOp("*") || p.isOp("/"):
+			op = p.tokens[p.pos].text
+		case p.isIdent("mod"):
+			op = "mod"
+		case p.isIdent("of") && left.percent:
+			op = "*"
+		default:
+			return left, nil
+		}
+		p.pos++
+
+		right, err := p.unary()
+		if err != nil {
+			return left, err
+		}
+
+		switch op {
+		case "*":
+			left = multiply(left, right, 1)
+		case "/":
+			if right.value == 0 {
+				return left, fmt.Errorf("division by zero")
+			}
+			left = multiply(left, right, -1)
+		case "mod":
+			if left.dims != right.dims {
+				return left, fmt.Errorf("can't mod %s and %s", left, right)
+			}
+			left.value = math.Mod(left.value, right.value)
+			left.rateDate = older(left.rateDate, right.rateDate)
+		}
+	}
+}
+
+// multiply multiplies a with b, or divides a by b if sign is -1.
+func multiply(a, b quantity, sign int) quantity {
+	q := quantity{value: a.value * math.Pow(b.value, float64(sign)), rateDate: older(a.rateDate, b.rateDate)}
+	for i := range q.dims {
+		q.dims[i] = a.dims[i] + sign*b.dims[i]
+	}
+
+	switch {
+	case q.dims == (dims{}):
+		// km / m is just a number
+	case b.dims == (dims{}):
+		q.unit = a.unit
+	case a.dims == (dims{}) && sign == 1:
+		q.unit = b.unit
+	case a.unit != nil && b.unit != nil:
+		sep := "*"
+		if sign < 0 {
+			sep = "/"
+		}
+		q.unit = &displayUnit{
+			name:   a.unit.name + sep + b.unit.name,
+			factor: a.unit.factor * math.Pow(b.unit.factor, float64(sign)),
+		}
+	}
+
+	return q
+}
+
+func (p *calcParser) unary() (quantity, error) {
+	if p.isOp("-") || p.isOp("+") {
+		neg := p.isOp("-")
+		p.pos++
+
+		q, err := p.unary()
+		if neg {
+			q.value = -q.value
+		}
+		return q, err
+	}
+
+	return p.power()
+}
+
+func (p *calcParser) power() (quantity, error) {
+	base, err := p.postfix()
+	if err != nil {
+		return base, err
+	}
+
+	if !p.isOp("**") {
+		return base, nil
+	}
+	p.pos++
+
+	exp, err := p.unary()
+	if err != nil {
+		return base, err
+	}
+
+	return pow(base, exp)
+}
+
+func pow(base, exp quantity) (quantity, error) {
+	if exp.dims != (dims{}) {
+		return base, fmt.Errorf("can't raise to the power of %s", exp)
+	}
+	if base.dims == (dims{}) {
+		return quantity{value: math.Pow(base.value, exp.value)}, nil
+	}
+
+	n := exp.value
+	if n != math.Trunc(n) {
+		return base, fmt.Errorf("can't raise %s to a fractional power", base)
+	}
+
+	q := quantity{value: math.Pow(base.value, n), rateDate: base.rateDate}
+	for i := range q.dims {
+		q.dims[i] = base.dims[i] * int(n)
+	}
+	if base.unit != nil {
+		q.unit = &displayUnit{name: fmt.Sprintf("%s^%d", base.unit.name, int(n)), factor: math.Pow(base.unit.factor, n)}
+	}
+	return q, nil
+}
+
+func (p *calcParser) postfix() (quantity, error) {
+	q, err := p.primary()
+	if err != nil {
+		return q, err
+	}
+
+	if p.isOp("%") {
+		p.pos++
+		if q.dims != (dims{}) || q.percent {
+			return q, fmt.Errorf("can't take percent of %s", q)
+		}
+		q.value /= 100
+		q.percent = true
+	}
+
+	return q, nil
+}
+
+func (p *calcParser) primary() (quantity, error) {
+	t, ok := p.peek()
+	if !ok {
+		return quantity{}, fmt.Errorf("unexpected end")
+	}
+	p.pos++
+
+	switch t.kind {
+	case tokenNumber:
+		q := quantity{value: t.num}
+
+		// units directly after numbers, e.g. `3km` or `2 m^2`
+		if next, ok := p.peek(); ok && next.kind == tokenIdent {
+			u, ok, err := p.unit(next.text)
+			if err != nil {
+				return q, err
+			}
+			if ok {
+				p.pos++
+				if p.isOp("**") && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].kind == tokenNumber {
+					p.pos++
+					exp := quantity{value: p.tokens[p.pos].num}
+					p.pos++
+					var err error
+					u, err = pow(u, exp)
+					if err != nil {
+						return q, err
+					}
+				}
+				q = multiply(q, u, 1)
+			} else if !calcKeywords[next.text] {
+				return q, fmt.Errorf("unknown unit %q", next.text)
+			}
+		}
+		return q, nil
+	case tokenIdent:
+		if p.isOp("(") {
+			return p.call(t.text)
+		}
+		u, ok, err := p.unit(t.text)
+		if err != nil || ok {
+			return u, err
+		}
+		return quantity{}, fmt.Errorf("unknown unit %q", t.text)
+	case tokenOp:
+		if t.text == "(" {
+			q, err := p.sum()
+			if err != nil {
+				return q, err
+			}
+			if !p.isOp(")") {
+				return q, fmt.Errorf("missing )")
+			}
+			p.pos++
+			return q, nil
+		}
+	}
+
+	return quantity{}, fmt.Errorf("unexpected %q", t.text)
+}
+
+// unit returns the variable, unit, currency or constant called name.
+func (p *calcParser) unit(name string) (quantity, bool, error) {
+	if c, ok := calcConstants[name]; ok {
+		return quantity{value: c}, true, nil
+	}
+
+	if value, ok := p.variables["var."+name]; ok {
+		// values of variables are simple, like `27.5 eur`
+		q, err := calculate(value, nil, p.currencies)
+		if err != nil {
+			return q, false, fmt.Errorf("invalid variable %s: %w", name, err)
+		}
+		return q, true, nil
+	}
+
+	if u, ok := calcUnits[name]; ok {
+		return quantity{value: u.factor, dims: u.dims, unit: &displayUnit{name: name, factor: u.factor}}, true, nil
+	}
+
+	if isCurrency(name) {
+		c, ok := p.currencies[strings.ToLower(name)]
+		if !ok {
+			return quantity{}, false, fmt.Errorf("no exchange rate for %s, try e.g. `setting rate %s/eur 1.23`", name, strings.ToLower(name))
+		}
+		return quantity{value: c.factor, dims: currencyDims, unit: &displayUnit{name: name, factor: c.factor}, rateDate: c.date}, true, nil
+	}
+
+	return quantity{}, false, nil
+}
+
+func (p *calcParser) call(name string) (quantity, error) {
+	p.pos++ // (
+
+	args := make([]quantity, 0, 1)
+	for !p.isOp(")") {
+		arg, err := p.sum()
+		if err != nil {
+			return arg, err
+		}
+		args = append(args, arg)
+
+		if p.isOp(",") {
+			p.pos++
+			continue
+		}
+		if !p.isOp(")") {
+			return quantity{}, fmt.Errorf("missing ) after arguments to %s", name)
+		}
+	}
+	p.pos++ // )
+
+	if fn, ok := calcFuncs[name]; ok {
+		if len(args) != 1 {
+			return quantity{}, fmt.Errorf("%s takes one argument", name)
+		}
+		arg := args[0]
+
+		if name == "sqrt" && arg.dims != (dims{}) {
+			q := quantity{value: math.Sqrt(arg.value)}
+			for i, n := range arg.dims {
+				if n%2 != 0 {
+					return q, fmt.Errorf("can't take the square root of %s", arg)
+				}
+				q.dims[i] = n / 2
+			}
+			return q, nil
+		}
+
+		if arg.dims != (dims{}) {
+			return quantity{}, fmt.Errorf("%s needs a number, not %s", name, arg)
+		}
+		return quantity{value: fn(arg.value)}, nil
+	}
+
+	if fn, ok := calcRoundFuncs[name]; ok {
+		if len(args) != 1 {
+			return quantity{}, fmt.Errorf("%s takes one argument", name)
+		}
+
+		q := args[0]
+		factor := 1.0
+		if q.unit != nil {
+			factor = q.unit.factor
+		}
+		q.value = fn(q.value/factor) * factor
+		return q, nil
+	}
+
+	if name == "min" || name == "max" {
+		if len(args) == 0 {
+			return quantity{}, fmt.Errorf("%s needs arguments", name)
+		}
+
+		q := args[0]
+		rateDate := q.rateDate
+		for _, arg := range args[1:] {
+			if arg.dims != q.dims {
+				return quantity{}, fmt.Errorf("%s needs arguments of the same unit", name)
+			}
+			if (name == "min" && arg.value < q.value) || (name == "max" && arg.value > q.value) {
+				q = arg
+			}
+			rateDate = older(rateDate, arg.rateDate)
+		}
+		q.rateDate = rateDate
+		return q, nil
+	}
+
+	return quantity{}, fmt.Errorf("unknown function %q", name)
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/heyLu/lp/go/things/storage"
+)
+
+func TestCalculate(t *testing.T) {
+	for expr, want := range map[string]string{
+		"1 + 2":          "3",
+		"1+2*3":          "7",
+		"(1+2)*3":        "9",
+		"2**10":          "1024",
+		"2^10":           "1024",
+		"-2**2":          "-4",
+		"2**-1":          "0.5",
+		"0.1+0.2":        "0.3",
+		"3 × 4 ÷ 2":      "6",
+		"10 mod 3":       "1",
+		"1_000 * 1e3":    "1000000",
+		"sqrt(16)":       "4",
+		"2 pi":           "6.28318530717959",
+		"max(1, 3, 2)":   "3",
+		"15%":            "15%",
+		"120 + 15%":      "138",
+		"100 - 10%":      "90",
+		"20% of 80":      "16",
+		"0.25 to %":      "25%",
+		"3km + 500m":     "3.5 km",
+		"1.5h to min":    "90 min",
+		"100km / 2h":     "50 km/h",
+		"60 mph to km/h": "96.56064 km/h",
+		"1 GiB to MB":    "1073.741824 MB",
+		"7 ft in m":      "2.1336 m",
+		"5 m^2":          "5 m^2",
+		"sqrt(16 m^2)":   "4 m",
+		"round(1.6 km)":  "2 km",
+		"max(1km, 800m)": "1 km",
+		"1 km / 1 m":     "1000",
+		"2 kg * 3 m":     "6 kg*m",
+	} {
+		got, err := Calculate(expr, nil)
+		require.NoError(t, err, expr)
+		require.Equal(t, want, got, expr)
+	}
+
+	for _, expr := range []string{"", "1 +", "(1", "3 kg + 2 m", "2/0", "30 parsecs", "foo(1)", "1 km to kg", "2 ** 1m", "1 $"} {
+		_, err := Calculate(expr, nil)
+		require.Error(t, err, expr)
+	}
+}
+
+func TestMathSetting(t *testing.T) {
+	ctx := WithSettings(context.Background(), Settings{"math": "builtin"})
+
+	thing, err := MathHandler{Qalc: true}.Parse(ctx, "2**10")
+	require.NoError(t, err)
+	renderer, err := MathHandler{Qalc: true}.Render(ctx, thing.ToRow())
+	require.NoError(t, err)
+	require.Equal(t, "1024", renderer.(TemplateRenderer).Data.(Math).Result())
+
+	_, err = SettingHandler{}.Parse(ctx, "setting math fancy")
+	require.Error(t, err)
+
+	_, err = SettingHandler{}.Parse(ctx, "setting math qalc")
+	_, notInstalled := exec.LookPath("qalc")
+	require.Equal(t, notInstalled != nil, err != nil)
+}
+
+func TestMathVariables(t *testing.T) {
+	ctx := WithSettings(context.Background(), Settings{"rate.eur/usd": "1.1 2024-08-15"})
+
+	thing, err := MathHandler{}.Parse(ctx, "x = 30usd to eur")
+	require.NoError(t, err)
+	row := thing.ToRow()
+	require.NoError(t, MathHandler{}.BeforeSave(ctx, nil, row))
+	require.Equal(t, "27.27 eur (rate of 2024-08-15)", row.Content.String)
+	require.Equal(t, "x", row.Fields["var"])
+
+	settings := SettingsFrom(ctx)
+	settings["var.x"] = row.Fields["value"].(string)
+
+	got, err := Calculate("x * 11", settings)
+	require.NoError(t, err)
+	require.Equal(t, "300.00 eur", got)
+
+	got, err = Calculate("2x to usd", settings)
+	require.NoError(t, err)
+	require.Equal(t, "60.00 usd (rate of 2024-08-15)", got)
+
+	_, err = MathHandler{}.Parse(ctx, "km = 3")
+	require.Error(t, err)
+
+	_, err = Calculate("y * 2", settings)
+	require.Error(t, err)
+
+	db, err := storage.NewDBStorage(ctx, ":memory:")
+	require.NoError(t, err)
+	row.Namespace = "test"
+	require.NoError(t, db.Insert(ctx, row))
+	require.NoError(t, db.Insert(ctx, &storage.Row{Metadata: storage.Metadata{Namespace: "test", Kind: "math"}, Summary: "1 + 1"}))
+
+	loaded, err := LoadSettings(ctx, db, "test")
+	require.NoError(t, err)
+	require.Equal(t, row.Fields["value"], loaded["var.x"])
+}
@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"context"
+	"html/template"
+	"slices"
+	"time"
+
+	"github.com/heyLu/lp/go/things/storage"
+)
+
+// Calendar is a month or a year of things, by the day they were created and
+// reminders and tasks on the day they are due.
+type Calendar struct {
+	Namespace string
+	Title     string
+
+	// Prev and Next are the inputs for the previous and next period
+	Prev string
+	Next string
+
+	// Compact calendars only show how many things there are on each day
+	Compact bool
+
+	Months []CalendarMonth
+}
+
+type CalendarMonth struct {
+	Title string
+	Input string
+
+	// Weeks start on monday, days of other months are zero
+	Weeks [][7]CalendarDay
+}
+
+type CalendarDay struct {
+	Date time.Time
+
+	Counts []KindCount
+	Due    []*storage.Row
+}
+
+type KindCount struct {
+	Kind  string
+	Count int
+}
+
+func (cd CalendarDay) Input() string {
+	return cd.Date.Format("2006-01-02")
+}
+
+// Total is the number of things created on the day.
+func (cd CalendarDay) Total() int {
+	total := 0
+	for _, count := range cd.Counts {
+		total += count.Count
+	}
+	return total
+}
+
+// loadCalendar returns the calendar of the month or year of byDate.
+func loadCalendar(ctx context.Context, db storage.Storage, namespace string, byDate *ByDate) (*Calendar, error) {
+	created, err := db.CountCreated(ctx, namespace, byDate.from, byDate.to)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(ctx, namespace,
+		storage.Or(storage.Kind("reminder"), storage.Kind("task")),
+		storage.Ge("time", byDate.from.Unix()),
+		storage.Lt("time", byDate.to.Unix()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	due, err := collectRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return newCalendar(namespace, byDate, created, due), nil
+}
+
+func newCalendar(namespace string, byDate *ByDate, created []storage.DayCount, due []*storage.Row) *Calendar {
+	loc := byDate.from.Location()
+
+	counts := make(map[string][]KindCount, 31)
+	for _, count := range created {
+		counts[count.Date] = append(counts[count.Date], KindCount{Kind: count.Kind, Count: count.Count})
+	}
+
+	dueOn := make(map[string][]*storage.Row, len(due))
+	slices.SortStableFunc(due, func(a, b *storage.Row) int { return a.Time.Time.Compare(b.Time.Time) })
+	for _, row := range due {
+		day := row.Time.Time.In(loc).Format("2006-01-02")
+		dueOn[day] = append(dueOn[day], row)
+	}
+
+	calendar := &Calendar{Namespace: namespace}
+	months := 1
+	if len(byDate.input) == len("2006") {
+		months = 12
+		calendar.Title = byDate.from.Format("2006")
+		calendar.Prev = byDate.from.AddDate(-1, 0, 0).Format("2006")
+		calendar.Next = byDate.to.Format("2006")
+		calendar.Compact = true
+	} else {
+		calendar.Title = byDate.from.Format("January 2006")
+		calendar.Prev = byDate.from.AddDate(0, -1, 0).Format("2006-01")
+		calendar.Next = byDate.to.Format("2006-01")
+	}
+
+	for i := range months {
+		first := byDate.from.AddDate(0, i, 0)
+		month := CalendarMonth{Title: first.Format("January 2006"), Input: first.Format("2006-01")}
+
+		var week [7]CalendarDay
+		for day := first; day.Month() == first.Month(); day = day.AddDate(0, 0, 1) {
+			weekday := (int(day.Weekday()) + 6) % 7
+			if weekday == 0 && day != first {
+				month.Weeks = append(month.Weeks, week)
+				week = [7]CalendarDay{}
+			}
+
+			key := day.Format("2006-01-02")
+			week[weekday] = CalendarDay{Date: day, Counts: counts[key], Due: dueOn[key]}
+		}
+		month.Weeks = append(month.Weeks, week)
+
+		calendar.Months = append(calendar.Months, month)
+	}
+
+	return calendar
+}
+
+var calendarTemplate = template.Must(template.New("").Funcs(commonFuncs).Parse(`
+{{ define "thing" }}
+<section class="calendar{{ if .Compact }} compact{{ end }}">
+	<header>
+		<a href="/{{ .Namespace }}/{{ .Prev }}" title="{{ .Prev }}">←</a>
+		<h1>{{ .Title }}</h1>
+		<a href="/{{ .Namespace }}/{{ .Next }}" title="{{ .Next }}">→</a>
+	</header>
+
+	{{ range .Months }}
+	<table>
+		{{ if $.Compact }}<caption><a href="/{{ $.Namespace }}/{{ .Input }}">{{ .Title }}</a></caption>{{ end }}
+		<thead>
+			<tr><th>mo</th><th>tu</th><th>we</th><th>th</th><th>fr</th><th>sa</th><th>su</th></tr>
+		</thead>
+		<tbody>
+			{{ range .Weeks }}
+			<tr>
+				{{ range . }}
+				{{ if .Date.IsZero }}
+				<td></td>
+				{{ else }}
+				<td{{ if or .Counts .Due }} class="busy"{{ end }}>
+					<a class="day" href="/{{ $.Namespace }}/{{ .Input }}">{{ .Date.Day }}</a>
+					{{ if $.Compact }}
+						{{ with .Total }}<span class="count" title="{{ . }} things">{{ . }}</span>{{ end }}
+					{{ else }}
+						{{ range .Counts }}<span class="count">{{ .Count }} {{ .Kind }}</span>{{ end }}
+						{{ range .Due }}
+						<a class="due {{ .Kind }}{{ if .Bool.Bool }} done{{ end }}" href="/{{ .Namespace }}/{{ .Kind }}/{{ .ID }}" title="{{ (local .Time.Time).Format "15:04" }}">{{ .Summary }}</a>
+						{{ end }}
+					{{ end }}
+				</td>
+				{{ end }}
+				{{ end }}
+			</tr>
+			{{ end }}
+		</tbody>
+	</table>
+	{{ end }}
+</section>
+{{ end }}
+`))
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/heyLu/lp/go/things/storage"
+)
+
+func TestCalendar(t *testing.T) {
+	ctx := WithLocation(context.Background(), time.UTC)
+	day := func(d int, hour int) time.Time { return time.Date(2024, 8, d, hour, 0, 0, 0, time.UTC) }
+
+	thing, err := ByDateHandler{}.Parse(ctx, "2024-08")
+	require.NoError(t, err)
+	calendar := newCalendar("test", thing.(*ByDate),
+		[]storage.DayCount{
+			{Date: "2024-08-15", Kind: "note", Count: 2},
+			{Date: "2024-08-15", Kind: "task", Count: 1},
+		},
+		[]*storage.Row{
+			{Metadata: storage.Metadata{Kind: "reminder"}, Summary: "later", Time: sql.NullTime{Time: day(31, 18), Valid: true}},
+			{Metadata: storage.Metadata{Kind: "task"}, Summary: "earlier", Time: sql.NullTime{Time: day(31, 9), Valid: true}},
+		},
+	)
+
+	require.Equal(t, "August 2024", calendar.Title)
+	require.Equal(t, "2024-07", calendar.Prev)
+	require.Equal(t, "2024-09", calendar.Next)
+	require.Len(t, calendar.Months, 1)
+
+	// august 2024 starts on a thursday and ends on a saturday
+	weeks := calendar.Months[0].Weeks
+	require.Len(t, weeks, 5)
+	require.True(t, weeks[0][2].Date.IsZero())
+	require.Equal(t, "2024-08-01", weeks[0][3].Input())
+	require.True(t, weeks[4][6].Date.IsZero())
+
+	thursday := weeks[2][3]
+	require.Equal(t, "2024-08-15", thursday.Input())
+	require.Equal(t, []KindCount{{"note", 2}, {"task", 1}}, thursday.Counts)
+	require.Equal(t, 3, thursday.Total())
+
+	saturday := weeks[4][5]
+	require.Equal(t, "2024-08-31", saturday.Input())
+	require.Equal(t, "earlier", saturday.Due[0].Summary)
+	require.Equal(t, "later", saturday.Due[1].Summary)
+
+	thing, err = ByDateHandler{}.Parse(ctx, "2024")
+	require.NoError(t, err)
+	calendar = newCalendar("test", thing.(*ByDate), nil, nil)
+	require.True(t, calendar.Compact)
+	require.Equal(t, "2025", calendar.Next)
+	require.Len(t, calendar.Months, 12)
+	require.Equal(t, "2024-12", calendar.Months[11].Input)
+}
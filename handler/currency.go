@@ -0,0 +1,273 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/heyLu/lp/go/things/storage"
+)
+
+// isoCurrencies are the active ISO 4217 currency codes.
+var isoCurrencies = strings.Fields(`
+	aed afn all amd ang aoa ars aud awg azn bam bbd bdt bgn bhd bif bmd bnd bob
+	brl bsd btn bwp byn bzd cad cdf chf clp cny cop crc cup cve czk djf dkk dop
+	dzd egp ern etb eur fjd fkp gbp gel ghs gip gmd gnf gtq gyd hkd hnl htg huf
+	idr ils inr iqd irr isk jmd jod jpy kes kgs khr kmf kpw krw kwd kyd kzt lak
+	lbp lkr lrd lsl lyd mad mdl mga mkd mmk mnt mop mru mur mvr mwk mxn myr mzn
+	nad ngn nio nok npr nzd omr pab pen pgk php pkr pln pyg qar ron rsd rub rwf
+	sar sbd scr sdg sek sgd shp sle sos srd ssp stn svc syp szl thb tjs tmt tnd
+	top try ttd twd tzs uah ugx usd uyu uzs ves vnd vuv wst xaf xcd xcg xof xpf
+	yer zar zmw zwg
+`)
+
+func isCurrency(code string) bool {
+	i := sort.SearchStrings(isoCurrencies, strings.ToLower(code))
+	return i < len(isoCurrencies) && isoCurrencies[i] == strings.ToLower(code)
+}
+
+// rateDateFormat is the format of dates in rate settings.
+const rateDateFormat = "2006-01-02"
+
+// parseRateSetting parses rate settings, like `rate.usd/eur` with the value
+// `0.91 2024-08-15`.
+func parseRateSetting(key string, value string) (storage.Rate, error) {
+	var rate storage.Rate
+
+	pair, ok := strings.CutPrefix(key, "rate.")
+	if !ok {
+		return rate, fmt.Errorf("not a rate: %q", key)
+	}
+
+	base, quote, ok := strings.Cut(pair, "/")
+	if !ok {
+		return rate, fmt.Errorf("invalid currency pair %q, try e.g. usd/eur", pair)
+	}
+	for _, code := range []string{base, quote} {
+		if !isCurrency(code) {
+			return rate, fmt.Errorf("unknown currency %q", code)
+		}
+	}
+	if strings.EqualFold(base, quote) {
+		return rate, fmt.Errorf("rate of %s to itself", base)
+	}
+	rate.Base, rate.Quote = strings.ToLower(base), strings.ToLower(quote)
+
+	fields := strings.Fields(value)
+	if len(fields) == 0 || len(fields) > 2 {
+		return rate, fmt.Errorf("usage: setting rate %s <rate> [date]", pair)
+	}
+
+	var err error
+	rate.Rate, err = strconv.ParseFloat(fields[0], 64)
+	if err != nil || rate.Rate <= 0 {
+		return rate, fmt.Errorf("invalid rate %q", fields[0])
+	}
+
+	if len(fields) == 2 {
+		rate.Date, err = time.Parse(rateDateFormat, fields[1])
+		if err != nil {
+			return rate, fmt.Errorf("invalid date %q, try e.g. 2024-08-15", fields[1])
+		}
+	}
+
+	return rate, nil
+}
+
+// Rates returns the exchange rates in s.
+func (s Settings) Rates() []storage.Rate {
+	rates := make([]storage.Rate, 0, len(s))
+	for key, value := range s {
+		if !strings.HasPrefix(key, "rate.") {
+			continue
+		}
+
+		rate, err := parseRateSetting(key, value)
+		if err != nil {
+			continue
+		}
+		rates = append(rates, rate)
+	}
+	return rates
+}
+
+func rateSetting(rate storage.Rate) (key string, value string) {
+	return "rate." + rate.Base + "/" + rate.Quote, strconv.FormatFloat(rate.Rate, 'f', -1, 64) + " " + rate.Date.Format(rateDateFormat)
+}
+
+// currency is the value of a currency in the reference currency.
+type currency struct {
+	factor float64
+	date   time.Time
+}
+
+// currencies converts rates to values in one reference currency, euro if
+// there are rates for it.  Currencies without a chain of rates to the
+// reference currency are left out.  If there are rates for both usd/eur and
+// eur/usd, the newer one is used.
+func currencies(rates []storage.Rate) map[string]currency {
+	if len(rates) == 0 {
+		return nil
+	}
+
+	newest := make(map[[2]string]storage.Rate, len(rates))
+	for _, rate := range rates {
+		pair := [2]string{min(rate.Base, rate.Quote), max(rate.Base, rate.Quote)}
+		if prev, ok := newest[pair]; !ok || rate.Date.After(prev.Date) {
+			newest[pair] = rate
+		}
+	}
+	pairs := slices.SortedFunc(maps.Keys(newest), func(a, b [2]string) int {
+		return strings.Compare(a[0]+a[1], b[0]+b[1])
+	})
+
+	neighbours := make(map[string][]storage.Rate, len(rates))
+	for _, pair := range pairs {
+		rate := newest[pair]
+		neighbours[rate.Base] = append(neighbours[rate.Base], rate)
+		neighbours[rate.Quote] = append(neighbours[rate.Quote], storage.Rate{Base: rate.Quote, Quote: rate.Base, Rate: 1 / rate.Rate, Date: rate.Date})
+	}
+
+	reference := "eur"
+	if _, ok := neighbours[reference]; !ok {
+		reference = pairs[0][0]
+	}
+
+	// breadth-first, so that conversions use as few rates as possible
+	found := map[string]currency{reference: {factor: 1}}
+	queue := []string{reference}
+	for len(queue) > 0 {
+		code := queue[0]
+		queue = queue[1:]
+
+		for _, rate := range neighbours[code] {
+			if _, ok := found[rate.Quote]; ok {
+				continue
+			}
+
+			// 1 base is rate quote, so 1 quote is 1/rate base
+			found[rate.Quote] = currency{
+				factor: found[code].factor / rate.Rate,
+				date:   older(found[code].date, rate.Date),
+			}
+			queue = append(queue, rate.Quote)
+		}
+	}
+
+	return found
+}
+
+// older returns the older of a and b, ignoring zero times.
+func older(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
+
+// ParseRates parses exchange rates in the XML or CSV formats of the European
+// Central Bank, see https://www.ecb.europa.eu/stats/eurofxref/.
+func ParseRates(r io.Reader) ([]storage.Rate, error) {
+	br := bufio.NewReader(r)
+	start, err := br.Peek(1)
+	if err != nil {
+		return nil, fmt.Errorf("empty rates: %w", err)
+	}
+
+	if bytes.Equal(start, []byte("<")) {
+		return parseRatesXML(br)
+	}
+	return parseRatesCSV(br)
+}
+
+func parseRatesXML(r io.Reader) ([]storage.Rate, error) {
+	var envelope struct {
+		Days []struct {
+			Time  string `xml:"time,attr"`
+			Rates []struct {
+				Currency string  `xml:"currency,attr"`
+				Rate     float64 `xml:"rate,attr"`
+			} `xml:"Cube"`
+		} `xml:"Cube>Cube"`
+	}
+	err := xml.NewDecoder(r).Decode(&envelope)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rates: %w", err)
+	}
+
+	rates := make([]storage.Rate, 0, 32)
+	for _, day := range envelope.Days {
+		date, err := time.Parse(rateDateFormat, day.Time)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date %q: %w", day.Time, err)
+		}
+
+		for _, rate := range day.Rates {
+			rates = append(rates, storage.Rate{Base: "eur", Quote: strings.ToLower(rate.Currency), Rate: rate.Rate, Date: date})
+		}
+	}
+
+	if len(rates) == 0 {
+		return nil, fmt.Errorf("no rates found")
+	}
+	return rates, nil
+}
+
+// parseRatesCSV parses rates with a header of currencies, like
+// `Date, USD, JPY,` followed by a line per day.
+func parseRatesCSV(r io.Reader) ([]storage.Rate, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid rates: %w", err)
+	}
+
+	rates := make([]storage.Rate, 0, 32)
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid rates: %w", err)
+		}
+
+		date, err := time.Parse("2 January 2006", record[0])
+		if err != nil {
+			date, err = time.Parse(rateDateFormat, record[0])
+			if err != nil {
+				return nil, fmt.Errorf("invalid date %q", record[0])
+			}
+		}
+
+		for i, field := range record[1:] {
+			if i+1 >= len(header) || !isCurrency(header[i+1]) {
+				continue
+			}
+
+			rate, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+			if err != nil {
+				// N/A for currencies without rates on that day
+				continue
+			}
+			rates = append(rates, storage.Rate{Base: "eur", Quote: strings.ToLower(header[i+1]), Rate: rate, Date: date})
+		}
+	}
+
+	if len(rates) == 0 {
+		return nil, fmt.Errorf("no rates found")
+	}
+	return rates, nil
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/heyLu/lp/go/things/storage"
+)
+
+func TestParseRates(t *testing.T) {
+	day := time.Date(2024, 8, 15, 0, 0, 0, 0, time.UTC)
+	want := []storage.Rate{
+		{Base: "eur", Quote: "usd", Rate: 1.1, Date: day},
+		{Base: "eur", Quote: "jpy", Rate: 162.5, Date: day},
+	}
+
+	rates, err := ParseRates(strings.NewReader(`<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<gesmes:subject>Reference rates</gesmes:subject>
+	<Cube>
+		<Cube time='2024-08-15'>
+			<Cube currency='USD' rate='1.1'/>
+			<Cube currency='JPY' rate='162.5'/>
+		</Cube>
+	</Cube>
+</gesmes:Envelope>`))
+	require.NoError(t, err)
+	require.Equal(t, want, rates)
+
+	rates, err = ParseRates(strings.NewReader("Date, USD, JPY, CYP, \n15 August 2024, 1.1, 162.5, N/A, \n"))
+	require.NoError(t, err)
+	require.Equal(t, want, rates)
+
+	_, err = ParseRates(strings.NewReader("Date, USD\nyesterday, 1.1\n"))
+	require.Error(t, err)
+}
+
+func TestCalculateCurrencies(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 8, d, 0, 0, 0, 0, time.UTC) }
+	rates := []storage.Rate{
+		{Base: "eur", Quote: "usd", Rate: 1.1, Date: day(15)},
+		{Base: "eur", Quote: "jpy", Rate: 160, Date: day(15)},
+		{Base: "chf", Quote: "eur", Rate: 1.05, Date: day(10)},
+		// newer than the usd rate above
+		{Base: "usd", Quote: "eur", Rate: 0.8, Date: day(16)},
+	}
+	settings := make(Settings, len(rates))
+	for _, rate := range rates {
+		key, value := rateSetting(rate)
+		settings[key] = value
+	}
+
+	for expr, want := range map[string]string{
+		"30 eur to usd":      "37.50 usd (rate of 2024-08-16)",
+		"30usd to eur":       "24.00 eur (rate of 2024-08-16)",
+		"160 JPY in EUR":     "1.00 EUR (rate of 2024-08-15)",
+		"10 chf + 5 eur":     "14.76 chf (rate of 2024-08-10)",
+		"1 chf to jpy":       "168.00 jpy (rate of 2024-08-10)",
+		"20 eur + 10%":       "22.00 eur",
+		"100 eur / 4 to eur": "25.00 eur",
+	} {
+		got, err := Calculate(expr, settings)
+		require.NoError(t, err, expr)
+		require.Equal(t, want, got, expr)
+	}
+
+	_, err := Calculate("30 gbp to eur", settings)
+	require.ErrorContains(t, err, "no exchange rate for gbp")
+
+	_, err = Calculate("30 eur to kg", settings)
+	require.Error(t, err)
+}
+
+func TestRateSetting(t *testing.T) {
+	ctx := WithLocation(context.Background(), time.UTC)
+
+	thing, err := SettingHandler{}.Parse(ctx, "setting rate usd/EUR 0.91")
+	require.NoError(t, err)
+	row := thing.ToRow()
+	require.Equal(t, "rate.usd/eur", row.Summary)
+	require.Equal(t, "0.91 "+Now(ctx).Format("2006-01-02"), row.Content.String)
+
+	thing, err = SettingHandler{}.Parse(ctx, "setting rate.usd/eur 0.91 2024-08-15")
+	require.NoError(t, err)
+	require.Equal(t, "0.91 2024-08-15", thing.ToRow().Content.String)
+
+	for _, invalid := range []string{"rate usd 0.91", "rate usd/xyz 0.91", "rate usd/usd 1", "rate usd/eur", "rate usd/eur -1", "rate usd/eur 1 yesterday"} {
+		_, err := SettingHandler{}.Parse(ctx, "setting "+invalid)
+		require.Error(t, err, invalid)
+	}
+
+	settings := Settings{"rate.usd/eur": "0.91 2024-08-15", "timezone": "UTC"}
+	require.Equal(t, []storage.Rate{{Base: "usd", Quote: "eur", Rate: 0.91, Date: time.Date(2024, 8, 15, 0, 0, 0, 0, time.UTC)}}, settings.Rates())
+
+	_, ok := MathHandler{}.CanHandle("usd to eur")
+	require.True(t, ok)
+	_, ok = MathHandler{}.CanHandle("car to buy")
+	require.False(t, ok)
+}
@@ -18,7 +18,7 @@ func (g *GenericHandler) CanHandle(input string) (string, bool) {
 }
 
 // Parse implements [Handler].
-func (g *GenericHandler) Parse(input string) (Thing, error) {
+func (g *GenericHandler) Parse(ctx context.Context, input string) (Thing, error) {
 	panic("unimplemented")
 }
 
@@ -88,6 +88,7 @@ var genericTemplate = template.Must(template.Must(commonTemplates.Clone()).Parse
 
 	<div class="field">
 		<input type="submit" value="save" />
+		<input type="submit" value="delete" formaction="/{{ .Namespace }}/{{ .Kind }}/{{ .ID }}/delete" />
 	</div>
 </form>
 {{ end }} 
@@ -7,27 +7,34 @@ import (
 	"html"
 	"html/template"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
 	"github.com/heyLu/lp/go/things/storage"
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
 )
 
 var All = Handlers([]Handler{
-	// TODO: bookmark <url> note
+	BookmarkHandler{},
 	ReminderHandler{},
 	TrackHandler{},
 	NoteHandler{},
 	LaterHandler{},
 	TaskHandler{},
+	TagsHandler{},
 	ByDateHandler{},
 	JavaScriptHandler{},
 	SettingHandler{},
+	SearchHandler{},
 	MathHandler{},
 	HelpHandler{},
 	OverviewHandler{},
-	SearchHandler{},
+	TrashHandler{},
 })
 
 type Handlers []Handler
@@ -53,12 +60,74 @@ func (hs Handlers) For(kind string) (string, Handler) {
 
 type Handler interface {
 	CanHandle(input string) (string, bool)
-	Parse(input string) (Thing, error)
+	Parse(ctx context.Context, input string) (Thing, error)
 
 	Query(ctx context.Context, db storage.Storage, namespace string, input string) (storage.Rows, error)
 	Render(ctx context.Context, row *storage.Row) (Renderer, error)
 }
 
+// BeforeSaver is implemented by handlers that need to do more work before a
+// thing is saved, e.g. fetching the title of a bookmark.  Parse is called for
+// every preview, so it should stay cheap.
+type BeforeSaver interface {
+	BeforeSave(ctx context.Context, db storage.Storage, row *storage.Row) error
+}
+
+// BeforeSave calls [BeforeSaver.BeforeSave] if hndl implements it.
+func BeforeSave(ctx context.Context, db storage.Storage, hndl Handler, row *storage.Row) error {
+	bs, ok := hndl.(BeforeSaver)
+	if !ok {
+		return nil
+	}
+	return bs.BeforeSave(ctx, db, row)
+}
+
+// Loader is implemented by handlers that show more than the thing itself,
+// e.g. the subtasks of a task.  Load loads the extra data for all of rows at
+// once, returning copies of them so that it is not saved accidentally.
+type Loader interface {
+	Load(ctx context.Context, db storage.Storage, rows []*storage.Row) ([]*storage.Row, error)
+}
+
+// Load calls [Loader.Load] if hndl implements it, returning rows otherwise.
+func Load(ctx context.Context, db storage.Storage, hndl Handler, rows ...*storage.Row) ([]*storage.Row, error) {
+	loader, ok := hndl.(Loader)
+	if !ok {
+		return rows, nil
+	}
+	return loader.Load(ctx, db, rows)
+}
+
+// Summarizer is implemented by handlers that show a summary above their
+// lists, e.g. the stats of a track category.  Summarize returns nil if there
+// is nothing to show for input.
+type Summarizer interface {
+	Summarize(ctx context.Context, db storage.Storage, namespace string, input string) (Renderer, error)
+}
+
+// Summarize calls [Summarizer.Summarize] if hndl implements it, returning nil
+// otherwise.
+func Summarize(ctx context.Context, db storage.Storage, hndl Handler, namespace string, input string) (Renderer, error) {
+	summarizer, ok := hndl.(Summarizer)
+	if !ok {
+		return nil, nil
+	}
+	return summarizer.Summarize(ctx, db, namespace, input)
+}
+
+// Editor is implemented by handlers whose things have actions besides
+// editing their values, e.g. snoozing a reminder.  Edit is called with the
+// form posted to /{namespace}/{kind}/{id}.
+type Editor interface {
+	Edit(ctx context.Context, row *storage.Row, form url.Values) error
+}
+
+// Grouper is implemented by handlers that group their lists by something
+// other than the day things were created, e.g. reminders by their state.
+type Grouper interface {
+	Group(ctx context.Context, row *storage.Row) string
+}
+
 type Thing interface {
 	ToRow() *storage.Row
 }
@@ -117,20 +186,41 @@ type TemplateRenderer struct {
 }
 
 func (tr TemplateRenderer) Render(ctx context.Context, w http.ResponseWriter) error {
-	return tr.Template.ExecuteTemplate(w, "thing", tr.Data)
+	links, ok := ctx.Value(linksKey{}).(*linkResolver)
+	tmpl, err := inLocation(tr.Template, Location(ctx), ok)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return links.execute(ctx, w, tmpl, tr.Data)
+	}
+	return tmpl.ExecuteTemplate(w, "thing", tr.Data)
 }
 
-var commonMarkdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+var commonMarkdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	// before links, which start with [ as well
+	goldmark.WithParserOptions(parser.WithInlineParsers(util.Prioritized(wikiLinkParser{}, 199))),
+	goldmark.WithRendererOptions(renderer.WithNodeRenderers(util.Prioritized(wikiLinkRenderer{}, 500))),
+)
+
+func markdown(md string, opts ...parser.ParseOption) (template.HTML, error) {
+	buf := new(bytes.Buffer)
+	err := commonMarkdown.Convert([]byte(md), buf, opts...)
+	if err != nil {
+		return "", err
+	}
+	return template.HTML(buf.String()), nil
+}
 
 var commonFuncs = template.FuncMap{
 	// TODO: linkify tags
 	"markdown": func(md string) (template.HTML, error) {
-		buf := new(bytes.Buffer)
-		err := commonMarkdown.Convert([]byte(md), buf)
-		if err != nil {
-			return "", err
-		}
-		return template.HTML(buf.String()), nil
+		return markdown(md)
+	},
+	// local converts times to the location of the namespace, see [inLocation]
+	"local": func(t time.Time) time.Time {
+		return t.Local()
 	},
 	"lines": func(s string) int {
 		return strings.Count(s, "\n")
@@ -150,14 +240,31 @@ var commonTemplates = template.Must(template.New("").Funcs(commonFuncs).Parse(`
 	<footer class="meta">
 		<div class="kind"><em>{{ .Kind }}</em></div>
 
-		<a href="/{{ .Namespace }}/{{ .Kind }}/{{ .ID }}"><time class="date-created" time="{{ .DateCreated }}" title="{{ .DateCreated }}">{{ .DateCreated.Format "2006-01-02 15:04:05" }}</time></a>
+		<a href="/{{ .Namespace }}/{{ .Kind }}/{{ .ID }}"><time class="date-created" time="{{ .DateCreated }}" title="{{ .DateCreated }}">{{ (local .DateCreated).Format "2006-01-02 15:04:05" }}</time></a>
 		{{ if (gt .DateModified.Unix 0) }}
-			<time class="date-modified" time="{{ .DateModified }}" title="{{ .DateModified}}">{{ .DateModified.Format "2006-01-02 15:04:05" }}</time>
+			<time class="date-modified" time="{{ .DateModified }}" title="{{ .DateModified}}">{{ (local .DateModified).Format "2006-01-02 15:04:05" }}</time>
 		{{ end }}
 
-		<div class="tags">{{ range .Tags }}{{ if (gt (len .) 1) }}<a href="/tag/{{ slice . 1 }}">{{ . }}</a> {{ end }}{{ end }}</div>
+		<div class="tags">{{ range .Tags }}{{ if (gt (len .) 1) }}<a href="/{{ $.Namespace }}/tag/{{ slice . 1 }}">{{ . }}</a> {{ end }}{{ end }}</div>
 
 		{{ if .Ref.Valid }}<div class="ref">see also: <a href="{{ .Ref.String }}">{{ .Ref.String }}</a></div>{{ end }}
+
+		{{ if (gt .ID 0) }}
+		<div class="actions">
+		{{ if .DateDeleted.IsZero }}
+			<a href="/{{ .Namespace }}/{{ .Kind }}/{{ .ID }}/history">history</a>
+			<form method="POST" action="/{{ .Namespace }}/{{ .Kind }}/{{ .ID }}/delete"
+				hx-delete="/{{ .Namespace }}/{{ .Kind }}/{{ .ID }}" hx-confirm="delete this {{ .Kind }}?" hx-target="closest section.thing" hx-swap="outerHTML">
+				<input type="submit" value="delete" />
+			</form>
+		{{ else }}
+			<time class="date-deleted" time="{{ .DateDeleted }}" title="{{ .DateDeleted }}">deleted {{ (local .DateDeleted).Format "2006-01-02 15:04:05" }}</time>
+			<form method="POST" action="/{{ .Namespace }}/{{ .Kind }}/{{ .ID }}/restore">
+				<input type="submit" value="restore" />
+			</form>
+		{{ end }}
+		</div>
+		{{ end }}
 	</footer>
 </section>
 {{ end }}
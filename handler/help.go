@@ -15,7 +15,7 @@ func (h HelpHandler) CanHandle(input string) (string, bool) {
 	return "help", strings.HasPrefix(input, "help")
 }
 
-func (h HelpHandler) Parse(input string) (Thing, error) {
+func (h HelpHandler) Parse(ctx context.Context, input string) (Thing, error) {
 	return Help(input), nil
 }
 
@@ -29,10 +29,24 @@ func (h HelpHandler) Render(ctx context.Context, row *storage.Row) (Renderer, er
 some examples:
 
 - reminder 30m go stretch a bit #health
+- remind tomorrow 9am call the bank
+- remind every monday 9:00 standup
+- task every 2w water plants
+- task !1 due:friday @home fix bike #errands
+- task parent:1724567890 buy brake pads
+- note bike, see [[task/1724567890]] and [[bike shops]]
+- task done, task all
+- later read, later all
+- 2024-08, for a calendar of august
 - track sleep 7.0 okay, went to bed too late
 - track mood 75 #tired
 - 2**10
 - 30usd to eur
+- x = 30usd to eur, then x * 12
+- setting rate usd/eur 0.91
+- setting timezone Europe/Berlin
+- setting archive 30
+- setting track.coffee unit=cups max=10
 `), nil
 }
 
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"html/template"
+	"strings"
+	"time"
+
+	"github.com/heyLu/lp/go/things/storage"
+)
+
+// HistoryRenderer renders the changes between the revisions of row, newest
+// first.
+func HistoryRenderer(row *storage.Row, revisions []storage.Revision) Renderer {
+	history := History{Row: row, Entries: make([]HistoryEntry, 0, len(revisions))}
+
+	newer := revisionText(row)
+	for _, rev := range revisions {
+		text := revisionText(&rev.Row)
+		history.Entries = append(history.Entries, HistoryEntry{
+			Revision: rev,
+			Diff:     Diff(text, newer),
+		})
+		newer = text
+	}
+
+	return TemplateRenderer{Template: historyTemplate, Data: history}
+}
+
+type History struct {
+	*storage.Row
+
+	Entries []HistoryEntry
+}
+
+type HistoryEntry struct {
+	storage.Revision
+
+	// Diff are the changes from this revision to the next newer one
+	Diff []DiffLine
+}
+
+// Date is when the revision was saved.
+func (he HistoryEntry) Date() time.Time {
+	if he.DateModified.Unix() > 0 {
+		return he.DateModified
+	}
+	return he.DateCreated
+}
+
+func revisionText(row *storage.Row) string {
+	text := row.Summary
+	if row.Content.Valid {
+		text += "\n\n" + row.Content.String
+	}
+	return text
+}
+
+type DiffLine struct {
+	// Op is ' ' for unchanged lines, '-' for removed ones and '+' for added ones.
+	Op   byte
+	Text string
+}
+
+// Diff returns the line-by-line changes to get from a to b.
+func Diff(a, b string) []DiffLine {
+	as := strings.Split(a, "\n")
+	bs := strings.Split(b, "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of as[i:] and bs[j:]
+	lcs := make([][]int, len(as)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bs)+1)
+	}
+	for i := len(as) - 1; i >= 0; i-- {
+		for j := len(bs) - 1; j >= 0; j-- {
+			if as[i] == bs[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	diff := make([]DiffLine, 0, max(len(as), len(bs)))
+	i, j := 0, 0
+	for i < len(as) && j < len(bs) {
+		switch {
+		case as[i] == bs[j]:
+			diff = append(diff, DiffLine{Op: ' ', Text: as[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, DiffLine{Op: '-', Text: as[i]})
+			i++
+		default:
+			diff = append(diff, DiffLine{Op: '+', Text: bs[j]})
+			j++
+		}
+	}
+	for ; i < len(as); i++ {
+		diff = append(diff, DiffLine{Op: '-', Text: as[i]})
+	}
+	for ; j < len(bs); j++ {
+		diff = append(diff, DiffLine{Op: '+', Text: bs[j]})
+	}
+
+	return diff
+}
+
+var historyTemplate = template.Must(template.New("").Funcs(commonFuncs).Parse(`
+{{ define "thing" }}
+<section class="history">
+	<h1>history of <a href="/{{ .Namespace }}/{{ .Kind }}/{{ .ID }}">{{ .Kind }}/{{ .ID }}</a></h1>
+
+	{{ range .Entries }}
+	<section class="revision">
+		<header>
+			revision {{ .Revision.Revision }}, <time time="{{ .Date }}" title="{{ .Date }}">{{ (local .Date).Format "2006-01-02 15:04:05" }}</time>
+			<form method="POST" action="/{{ .Namespace }}/{{ .Kind }}/{{ .ID }}/history/{{ .Revision.Revision }}/restore">
+				<input type="submit" value="restore" />
+			</form>
+		</header>
+
+		<pre class="diff">{{ range .Diff }}<span class="diff-line{{ if (eq .Op '+') }} diff-added{{ else if (eq .Op '-') }} diff-removed{{ end }}">{{ printf "%c" .Op }} {{ .Text }}</span>
+{{ end }}</pre>
+	</section>
+	{{ else }}
+	<p>no prior versions</p>
+	{{ end }}
+</section>
+{{ end }}
+`))
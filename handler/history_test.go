@@ -0,0 +1,22 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	require.Equal(t,
+		[]DiffLine{
+			{' ', "buy milk"},
+			{'-', "fix the bike"},
+			{'+', "fix the bike, again"},
+			{' ', "call them"},
+			{'+', "water plants"},
+		},
+		Diff("buy milk\nfix the bike\ncall them", "buy milk\nfix the bike, again\ncall them\nwater plants"),
+	)
+
+	require.Equal(t, []DiffLine{{' ', "same"}}, Diff("same", "same"))
+}
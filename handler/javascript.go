@@ -16,7 +16,7 @@ func (j JavaScriptHandler) CanHandle(input string) (string, bool) {
 	return "javascript", strings.HasPrefix(input, "javascript") || strings.HasPrefix(input, "js")
 }
 
-func (j JavaScriptHandler) Parse(input string) (Thing, error) {
+func (j JavaScriptHandler) Parse(ctx context.Context, input string) (Thing, error) {
 	parts := strings.SplitN(input, " ", 2)
 	if len(parts) < 2 {
 		return JavaScript("/* your code here ✨ */"), nil
@@ -16,7 +16,7 @@ func (nh LaterHandler) CanHandle(input string) (string, bool) {
 	return "later", strings.HasPrefix(input, "later")
 }
 
-func (nh LaterHandler) Parse(input string) (Thing, error) {
+func (nh LaterHandler) Parse(ctx context.Context, input string) (Thing, error) {
 	idx := strings.Index(input, " ")
 	if idx == -1 {
 		idx = len(input)
@@ -35,12 +35,15 @@ func (nh LaterHandler) Parse(input string) (Thing, error) {
 	return later, nil
 }
 
+// Query lists unread things, or read ones with `later read` and everything
+// with `later all`.
 func (nh LaterHandler) Query(ctx context.Context, db storage.Storage, namespace string, input string) (storage.Rows, error) {
-	parts := strings.SplitN(input, " ", 2)
-	if len(parts) == 1 {
-		return db.Query(ctx, namespace, storage.Kind("later"))
-	}
-	return db.Query(ctx, namespace, storage.Kind("later"), storage.Match("summary", parts[1]))
+	_, query, _ := strings.Cut(input, " ")
+	query, conditions := doneConditions(query, "read")
+
+	terms, queryConditions := parseKindQuery(ctx, query)
+	conditions = append(conditions, storage.Kind("later"))
+	return db.Search(ctx, namespace, terms, append(conditions, queryConditions...)...)
 }
 
 func (nh LaterHandler) Render(ctx context.Context, row *storage.Row) (Renderer, error) {
@@ -59,5 +62,11 @@ func (n Later) ToRow() *storage.Row { return n.Row }
 var laterTemplate = template.Must(template.Must(commonTemplates.Clone()).Parse(`
 {{ define "content" }}
 <div>{{ markdown .Summary }}</div>
+<label class="later-read">
+	<input type="checkbox" name="bool"{{ if .Bool.Bool }} checked{{ end }}
+		{{ if (gt .ID 0) }} hx-post="/{{ .Namespace }}/{{ .Kind }}/{{ .ID }}" hx-vals='{"bool-valid": "true"}' hx-swap="none"{{ else }} disabled{{ end }}
+		/>
+	read
+</label>
 {{ end }} 
 `))
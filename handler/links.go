@@ -0,0 +1,366 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+
+	"github.com/heyLu/lp/go/things/storage"
+)
+
+var (
+	// wikiLinkStartRe matches a link to another thing at the start of the
+	// input, see [storage.Links].
+	wikiLinkStartRe = regexp.MustCompile(`^\[\[([^\[\]\n]+)\]\]`)
+	thingRefRe      = regexp.MustCompile(`^([a-z]+)/([0-9]+)$`)
+	// wikiLinkMarkerRe matches the links rendered by [wikiLinkRenderer].
+	wikiLinkMarkerRe = regexp.MustCompile(`<a data-wiki-link="([^"]*)">`)
+)
+
+// ResolveLink returns the thing `[[target]]` links to, see [ResolveLinks].
+func ResolveLink(ctx context.Context, db storage.Storage, namespace string, target string) (*storage.Row, error) {
+	resolved, err := ResolveLinks(ctx, db, namespace, []string{target})
+	if err != nil {
+		return nil, err
+	}
+
+	row, ok := resolved[target]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return row, nil
+}
+
+// ResolveLinks returns the things targets link to in one query, by kind and
+// id like `task/1724567890` or else the newest thing with the target as its
+// summary.  Targets that don't resolve are missing from the result.
+func ResolveLinks(ctx context.Context, db storage.Storage, namespace string, targets []string) (map[string]*storage.Row, error) {
+	resolved := make(map[string]*storage.Row, len(targets))
+
+	conditions := make([]storage.Condition, 0, len(targets))
+	for _, target := range targets {
+		if m := thingRefRe.FindStringSubmatch(target); m != nil {
+			id, err := strconv.ParseInt(m[2], 10, 64)
+			if err != nil {
+				continue
+			}
+			conditions = append(conditions, storage.Eq("id", id))
+		} else {
+			conditions = append(conditions, storage.Summary(target))
+		}
+	}
+	if len(conditions) == 0 {
+		return resolved, nil
+	}
+
+	rows, err := db.Query(ctx, namespace, storage.Or(conditions...))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row storage.Row
+		err := rows.Scan(&row)
+		if err != nil {
+			return nil, err
+		}
+
+		// newest first, so the first thing with a summary wins
+		for _, target := range []string{row.Kind + "/" + strconv.FormatInt(row.ID, 10), row.Summary} {
+			if _, ok := resolved[target]; !ok && slices.Contains(targets, target) {
+				resolved[target] = &row
+			}
+		}
+	}
+
+	return resolved, rows.Close()
+}
+
+// BrokenLinks returns the targets of links in row that don't resolve.
+func BrokenLinks(ctx context.Context, db storage.Storage, row *storage.Row) ([]string, error) {
+	links := storage.Links(row)
+	resolved, err := ResolveLinks(ctx, db, row.Namespace, links)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(links, func(target string) bool {
+		_, ok := resolved[target]
+		return ok
+	}), nil
+}
+
+// Backlinks returns the things that link to row, by its kind and id or its
+// summary.
+func Backlinks(ctx context.Context, db storage.Storage, row *storage.Row) ([]*storage.Row, error) {
+	targets := []string{row.Kind + "/" + strconv.FormatInt(row.ID, 10)}
+	if wikiLinkStartRe.MatchString("[[" + row.Summary + "]]") {
+		targets = append(targets, row.Summary)
+	}
+
+	rows, err := db.Query(ctx, row.Namespace, storage.LinksTo(targets...), storage.Not(storage.Eq("id", row.ID)))
+	if err != nil {
+		return nil, err
+	}
+
+	return collectRows(rows)
+}
+
+type linksKey struct{}
+
+// linkResolver resolves the `[[links]]` of one request, remembering them so
+// that a page needs only a query or two for all of its links.
+type linkResolver struct {
+	db        storage.Storage
+	namespace string
+
+	mu    sync.Mutex
+	links map[string]wikiLink
+}
+
+// WithLinks returns a context that makes markdown link `[[links]]` to the
+// things in namespace, see [ResolveLinks].  It should be used for one request
+// only, because links are not resolved again.
+func WithLinks(ctx context.Context, db storage.Storage, namespace string) context.Context {
+	return context.WithValue(ctx, linksKey{}, &linkResolver{
+		db:        db,
+		namespace: namespace,
+		links:     make(map[string]wikiLink),
+	})
+}
+
+// LoadLinks resolves the links of all rows at once, e.g. of a list, so that
+// rendering them doesn't need a query each.  It does nothing without
+// [WithLinks].
+func LoadLinks(ctx context.Context, rows ...*storage.Row) error {
+	lr, ok := ctx.Value(linksKey{}).(*linkResolver)
+	if !ok {
+		return nil
+	}
+
+	targets := make([]string, 0, len(rows))
+	for _, row := range rows {
+		targets = append(targets, storage.Links(row)...)
+	}
+	return lr.load(ctx, targets)
+}
+
+// wikiLink is the link to the thing target refers to, and whether it exists.
+type wikiLink struct {
+	href  string
+	title string
+	found bool
+}
+
+// load resolves the targets that weren't resolved yet.
+func (lr *linkResolver) load(ctx context.Context, targets []string) error {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	missing := make([]string, 0, len(targets))
+	for _, target := range targets {
+		if _, ok := lr.links[target]; !ok && !slices.Contains(missing, target) {
+			missing = append(missing, target)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	resolved, err := ResolveLinks(ctx, lr.db, lr.namespace, missing)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range missing {
+		lr.links[target] = lr.link(target, resolved[target])
+	}
+	return nil
+}
+
+// link returns the link to row, or to what would fix the link if it is nil.
+func (lr *linkResolver) link(target string, row *storage.Row) wikiLink {
+	if row == nil {
+		link := wikiLink{title: "nothing is called " + target}
+		if m := thingRefRe.FindStringSubmatch(target); m != nil {
+			link.href = "/" + url.PathEscape(lr.namespace) + "/" + target
+		} else {
+			// the note that would fix the link, ready to be saved
+			link.href = "/" + url.PathEscape(lr.namespace) + "/note?" + url.Values{"tell-me": {"note " + target}}.Encode()
+		}
+		return link
+	}
+
+	title, _, _ := strings.Cut(row.Summary, "\n")
+	return wikiLink{
+		href:  "/" + url.PathEscape(row.Namespace) + "/" + url.PathEscape(row.Kind) + "/" + strconv.FormatInt(row.ID, 10),
+		title: title,
+		found: true,
+	}
+}
+
+// execute executes tmpl, whose markdown marks `[[links]]` (see
+// [inLocation]), and replaces the marks with links to the things they
+// resolve to.  Links that were not loaded before are resolved at once.
+func (lr *linkResolver) execute(ctx context.Context, w io.Writer, tmpl *template.Template, data any) error {
+	buf := new(bytes.Buffer)
+	err := tmpl.ExecuteTemplate(buf, "thing", data)
+	if err != nil {
+		return err
+	}
+
+	marks := wikiLinkMarkerRe.FindAllSubmatch(buf.Bytes(), -1)
+	if len(marks) == 0 {
+		_, err := buf.WriteTo(w)
+		return err
+	}
+
+	targets := make([]string, 0, len(marks))
+	for _, m := range marks {
+		targets = append(targets, html.UnescapeString(string(m[1])))
+	}
+	err = lr.load(ctx, targets)
+	if err != nil {
+		return err
+	}
+
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	linked := wikiLinkMarkerRe.ReplaceAllFunc(buf.Bytes(), func(mark []byte) []byte {
+		target := html.UnescapeString(string(wikiLinkMarkerRe.FindSubmatch(mark)[1]))
+		link := lr.links[target]
+		class := "wiki-link"
+		if !link.found {
+			class += " broken"
+		}
+		return fmt.Appendf(nil, `<a href="%s" title="%s" class="%s">`, html.EscapeString(link.href), html.EscapeString(link.title), class)
+	})
+	_, err = w.Write(linked)
+	return err
+}
+
+// linkedMarkdown is markdown that marks `[[links]]` for
+// [linkResolver.execute].
+func linkedMarkdown(md string) (template.HTML, error) {
+	pc := parser.NewContext()
+	pc.Set(wikiLinksKey, true)
+	return markdown(md, parser.WithContext(pc))
+}
+
+var wikiLinksKey = parser.NewContextKey()
+
+// wikiLinkParser parses `[[links]]`, if they are enabled in the parser
+// context.  Otherwise they stay text.
+type wikiLinkParser struct{}
+
+func (wp wikiLinkParser) Trigger() []byte {
+	return []byte{'['}
+}
+
+func (wp wikiLinkParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	if pc.Get(wikiLinksKey) == nil {
+		return nil
+	}
+
+	line, segment := block.PeekLine()
+	m := wikiLinkStartRe.FindSubmatchIndex(line)
+	if m == nil {
+		return nil
+	}
+	block.Advance(m[1])
+
+	label := text.NewSegment(segment.Start+m[2], segment.Start+m[3])
+	label = label.TrimLeftSpace(block.Source())
+	label = label.TrimRightSpace(block.Source())
+	link := &wikiLinkNode{target: string(label.Value(block.Source()))}
+	link.AppendChild(link, ast.NewTextSegment(label))
+	return link
+}
+
+var kindWikiLink = ast.NewNodeKind("WikiLink")
+
+// wikiLinkNode is a `[[link]]` to target, not resolved yet.
+type wikiLinkNode struct {
+	ast.BaseInline
+
+	target string
+}
+
+func (n *wikiLinkNode) Kind() ast.NodeKind {
+	return kindWikiLink
+}
+
+func (n *wikiLinkNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Target": n.target}, nil)
+}
+
+// wikiLinkRenderer renders `[[links]]` as marks that [linkResolver.execute]
+// replaces with the actual links.
+type wikiLinkRenderer struct{}
+
+func (wr wikiLinkRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindWikiLink, func(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			fmt.Fprintf(w, `<a data-wiki-link="%s">`, html.EscapeString(node.(*wikiLinkNode).target))
+		} else {
+			w.WriteString("</a>")
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+// LinksRenderer renders the things linking to row and its broken links.
+func LinksRenderer(row *storage.Row, backlinks []*storage.Row, broken []string) Renderer {
+	return TemplateRenderer{
+		Template: linksTemplate,
+		Data: struct {
+			*storage.Row
+
+			Backlinks []*storage.Row
+			Broken    []string
+		}{row, backlinks, broken},
+	}
+}
+
+var linksTemplate = template.Must(template.New("").Funcs(commonFuncs).Parse(`
+{{ define "thing" }}
+{{ if or .Backlinks .Broken }}
+<section class="links">
+	{{ with .Backlinks }}
+	<h2>linked from</h2>
+	<ul>
+		{{ range . }}
+		<li><a href="/{{ .Namespace }}/{{ .Kind }}/{{ .ID }}">{{ .Summary }}</a> <em>{{ .Kind }}</em></li>
+		{{ end }}
+	</ul>
+	{{ end }}
+
+	{{ with .Broken }}
+	<h2>broken links</h2>
+	<ul>
+		{{ range . }}
+		<li class="broken">[[{{ . }}]]</li>
+		{{ end }}
+	</ul>
+	{{ end }}
+</section>
+{{ end }}
+{{ end }}
+`))
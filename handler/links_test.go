@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/heyLu/lp/go/things/storage"
+)
+
+// countingStorage counts the queries made through it.
+type countingStorage struct {
+	storage.Storage
+	queries int
+}
+
+func (cs *countingStorage) Query(ctx context.Context, namespace string, conditions ...storage.Condition) (storage.Rows, error) {
+	cs.queries++
+	return cs.Storage.Query(ctx, namespace, conditions...)
+}
+
+func TestLinks(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.NewDBStorage(ctx, ":memory:")
+	require.NoError(t, err)
+
+	insert := func(kind string, summary string, content string) *storage.Row {
+		row := &storage.Row{
+			Metadata: storage.Metadata{Namespace: "test", Kind: kind},
+			Summary:  summary,
+			Content:  sql.NullString{String: content, Valid: content != ""},
+		}
+		require.NoError(t, db.Insert(ctx, row))
+		return row
+	}
+
+	bike := insert("note", "bike", "")
+	task := insert("task", "fix [[bike]]", "")
+	taskLink := "task/" + strconv.FormatInt(task.ID, 10)
+	note := insert("note", "plans", "see [[ bike ]] and [["+taskLink+"]], but not [[car]] or [[task/1]]")
+	insert("note", "Bike", "about [[Bike]] itself, not [[bike]]")
+
+	require.Equal(t, []string{"bike", taskLink, "car", "task/1"}, storage.Links(note))
+
+	found, err := ResolveLink(ctx, db, "test", taskLink)
+	require.NoError(t, err)
+	require.Equal(t, task.ID, found.ID)
+	_, err = ResolveLink(ctx, db, "test", "note/"+strconv.FormatInt(task.ID, 10))
+	require.ErrorIs(t, err, storage.ErrNotFound)
+
+	broken, err := BrokenLinks(ctx, db, note)
+	require.NoError(t, err)
+	require.Equal(t, []string{"car", "task/1"}, broken)
+
+	backlinks, err := Backlinks(ctx, db, bike)
+	require.NoError(t, err)
+	summaries := []string{}
+	for _, row := range backlinks {
+		summaries = append(summaries, row.Summary)
+	}
+	require.Equal(t, []string{"Bike", "plans", "fix [[bike]]"}, summaries)
+
+	backlinks, err = Backlinks(ctx, db, task)
+	require.NoError(t, err)
+	require.Len(t, backlinks, 1)
+
+	renderer, err := NoteHandler{}.Render(ctx, note)
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	require.NoError(t, renderer.Render(ctx, rec))
+	require.Contains(t, rec.Body.String(), "[[car]]")
+
+	ctx = WithLinks(ctx, db, "test")
+	rec = httptest.NewRecorder()
+	require.NoError(t, renderer.Render(ctx, rec))
+	require.Contains(t, rec.Body.String(), `<a href="/test/note/`+strconv.FormatInt(bike.ID, 10)+`" title="bike" class="wiki-link">bike</a>`)
+	require.Contains(t, rec.Body.String(), `<a href="/test/`+taskLink+`"`)
+	require.Contains(t, rec.Body.String(), `<a href="/test/note?tell-me=note+car" title="nothing is called car" class="wiki-link broken">car</a>`)
+	require.Contains(t, rec.Body.String(), `class="wiki-link broken">task/1</a>`)
+
+	// one query for all links of a page
+	counting := &countingStorage{Storage: db}
+	ctx = WithLinks(context.Background(), counting, "test")
+	require.NoError(t, LoadLinks(ctx, note, task))
+	require.Equal(t, 1, counting.queries)
+	for _, row := range []*storage.Row{note, task} {
+		renderer, err := NoteHandler{}.Render(ctx, row)
+		require.NoError(t, err)
+		require.NoError(t, renderer.Render(ctx, httptest.NewRecorder()))
+	}
+	require.Equal(t, 1, counting.queries)
+
+	// backlinks follow edits
+	note.Content = sql.NullString{String: "no more links", Valid: true}
+	require.NoError(t, db.Update(ctx, note))
+	backlinks, err = Backlinks(ctx, db, task)
+	require.NoError(t, err)
+	require.Empty(t, backlinks)
+}
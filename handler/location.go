@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"context"
+	"html/template"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/heyLu/lp/go/things/storage"
+)
+
+type locationKey struct{}
+type settingsKey struct{}
+
+// WithSettings returns a context with the settings of a namespace, and its
+// timezone unless that is invalid.
+func WithSettings(ctx context.Context, settings Settings) context.Context {
+	ctx = context.WithValue(ctx, settingsKey{}, settings)
+
+	loc, err := settings.Location()
+	if err != nil {
+		return ctx
+	}
+	return WithLocation(ctx, loc)
+}
+
+// WithLazySettings returns a context like [WithSettings], but the settings
+// of namespace are only loaded once they are used, e.g. not for requests
+// that don't show or parse anything.  If only the timezone is used, only it
+// is loaded.
+//
+// Settings that fail to load are logged and treated as empty.
+func WithLazySettings(ctx context.Context, db storage.Storage, namespace string) context.Context {
+	return context.WithValue(ctx, settingsKey{}, &lazySettings{db: db, namespace: namespace})
+}
+
+// lazySettings are the settings of a namespace, loaded on first use.
+type lazySettings struct {
+	db        storage.Storage
+	namespace string
+
+	mu       sync.Mutex
+	settings Settings
+	location *time.Location
+}
+
+func (ls *lazySettings) get(ctx context.Context) Settings {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if ls.settings == nil {
+		settings, err := LoadSettings(ctx, ls.db, ls.namespace)
+		if err != nil {
+			log.Printf("settings of %s: %s", ls.namespace, err)
+			settings = Settings{}
+		}
+		ls.settings = settings
+	}
+	return ls.settings
+}
+
+func (ls *lazySettings) getLocation(ctx context.Context) *time.Location {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if ls.location != nil {
+		return ls.location
+	}
+
+	timezone, ok := ls.settings["timezone"]
+	if ls.settings == nil {
+		var err error
+		timezone, ok, err = loadSetting(ctx, ls.db, ls.namespace, "timezone")
+		if err != nil {
+			log.Printf("settings of %s: %s", ls.namespace, err)
+		}
+	}
+
+	ls.location = time.Local
+	if ok {
+		loc, err := Settings{"timezone": timezone}.Location()
+		if err == nil {
+			ls.location = loc
+		}
+	}
+	return ls.location
+}
+
+// SettingsFrom returns the settings set with [WithSettings] or
+// [WithLazySettings].
+func SettingsFrom(ctx context.Context) Settings {
+	switch settings := ctx.Value(settingsKey{}).(type) {
+	case Settings:
+		return settings
+	case *lazySettings:
+		return settings.get(ctx)
+	}
+	return nil
+}
+
+// WithLocation returns a context that makes handlers parse and show times in
+// loc, usually the timezone setting of the namespace.
+func WithLocation(ctx context.Context, loc *time.Location) context.Context {
+	return context.WithValue(ctx, locationKey{}, loc)
+}
+
+// Location returns the location set with [WithLocation], or the local one of
+// the server.
+func Location(ctx context.Context) *time.Location {
+	loc, ok := ctx.Value(locationKey{}).(*time.Location)
+	if ok && loc != nil {
+		return loc
+	}
+	if settings, ok := ctx.Value(settingsKey{}).(*lazySettings); ok {
+		return settings.getLocation(ctx)
+	}
+	return time.Local
+}
+
+// Now returns the current time in the location of ctx.
+func Now(ctx context.Context) time.Time {
+	return time.Now().In(Location(ctx))
+}
+
+type localTemplateKey struct {
+	tmpl     *template.Template
+	location string
+	links    bool
+}
+
+// localTemplates are clones of templates whose `local` func converts times
+// to a location, see [inLocation].
+var localTemplates sync.Map
+
+// inLocation returns a clone of tmpl that shows times in loc, and whose
+// markdown marks `[[links]]` for [linkResolver.execute] if links is set.
+//
+// tmpl itself is never executed, because templates cannot be cloned after
+// that anymore.
+func inLocation(tmpl *template.Template, loc *time.Location, links bool) (*template.Template, error) {
+	key := localTemplateKey{tmpl: tmpl, location: loc.String(), links: links}
+	if local, ok := localTemplates.Load(key); ok {
+		return local.(*template.Template), nil
+	}
+
+	local, err := tmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	local.Funcs(template.FuncMap{
+		"local": func(t time.Time) time.Time { return t.In(loc) },
+	})
+	if links {
+		local.Funcs(template.FuncMap{"markdown": linkedMarkdown})
+	}
+
+	actual, _ := localTemplates.LoadOrStore(key, local)
+	return actual.(*template.Template), nil
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/heyLu/lp/go/things/storage"
+)
+
+func TestRenderInLocation(t *testing.T) {
+	row := &storage.Row{
+		Metadata: storage.Metadata{
+			Namespace:   "test",
+			Kind:        "reminder",
+			ID:          1,
+			DateCreated: time.Date(2024, 8, 15, 22, 30, 0, 0, time.UTC),
+		},
+		Summary: "dentist",
+		Time:    sql.NullTime{Time: time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC), Valid: true},
+	}
+
+	for loc, want := range map[string][]string{
+		"UTC":           {"2024-08-15 22:30:00", "Sun, 01 Sep 2024 12:00"},
+		"Europe/Berlin": {"2024-08-16 00:30:00", "Sun, 01 Sep 2024 14:00"},
+	} {
+		location, err := time.LoadLocation(loc)
+		require.NoError(t, err)
+		ctx := WithLocation(context.Background(), location)
+
+		renderer, err := ReminderHandler{}.Render(ctx, row)
+		require.NoError(t, err)
+
+		rec := httptest.NewRecorder()
+		require.NoError(t, renderer.Render(ctx, rec))
+		for _, s := range want {
+			require.Contains(t, rec.Body.String(), s, loc)
+		}
+	}
+}
+
+func TestLazySettings(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.NewDBStorage(ctx, ":memory:")
+	require.NoError(t, err)
+
+	for _, setting := range []string{"timezone Europe/Berlin", "math builtin"} {
+		thing, err := SettingHandler{}.Parse(ctx, "setting "+setting)
+		require.NoError(t, err)
+		row := thing.ToRow()
+		row.Namespace = "test"
+		require.NoError(t, db.Insert(ctx, row))
+	}
+
+	counting := &countingStorage{Storage: db}
+	ctx = WithLazySettings(ctx, counting, "test")
+	require.Zero(t, counting.queries)
+
+	// only the timezone
+	require.Equal(t, "Europe/Berlin", Location(ctx).String())
+	require.Equal(t, 1, counting.queries)
+	Location(ctx)
+	require.Equal(t, 1, counting.queries)
+
+	require.Equal(t, "builtin", SettingsFrom(ctx)["math"])
+	queries := counting.queries
+	SettingsFrom(ctx)
+	require.Equal(t, queries, counting.queries)
+}
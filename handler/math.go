@@ -3,33 +3,129 @@ package handler
 import (
 	"bytes"
 	"context"
+	"database/sql"
 	"fmt"
+	"html/template"
 	"os/exec"
 	"regexp"
+	"strings"
 
 	"github.com/heyLu/lp/go/things/storage"
 )
 
 var _ Handler = MathHandler{}
+var _ BeforeSaver = MathHandler{}
 
-var mathRe = regexp.MustCompile(`([0-9]|eur|usd)`)
+// mathRe matches anything with numbers, and currency conversions like `usd
+// to eur`
+var mathRe = regexp.MustCompile(`[0-9]|(?i)\b(` + strings.Join(isoCurrencies, "|") + `) +(to|in) +(` + strings.Join(isoCurrencies, "|") + `)\b`)
 
-type MathHandler struct{}
+// assignmentRe matches variable assignments like `x = 30usd to eur`
+var assignmentRe = regexp.MustCompile(`^\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*=\s*(.+)$`)
+
+type MathHandler struct {
+	// Qalc uses qalc instead of the builtin [Calculate], unless the `math`
+	// setting says otherwise
+	Qalc bool
+}
 
 func (mh MathHandler) CanHandle(input string) (string, bool) {
-	return "math", mathRe.MatchString(input)
+	return "math", input == "math" || strings.HasPrefix(input, "math ") || mathRe.MatchString(input)
 }
 
-func (mh MathHandler) Parse(input string) (Thing, error) {
-	return Math(input), nil
+func (mh MathHandler) Parse(ctx context.Context, input string) (Thing, error) {
+	// listing past calculations
+	if input == "math" || strings.HasPrefix(input, "math ") {
+		return Math{Row: &storage.Row{Metadata: storage.Metadata{Kind: "math"}}}, nil
+	}
+
+	if name, _, ok := parseAssignment(input); ok && isCalcName(name) {
+		return nil, fmt.Errorf("can't name a variable %q, it is a unit or function already", name)
+	}
+
+	return Math{
+		Row: &storage.Row{
+			Metadata: storage.Metadata{
+				Kind: "math",
+			},
+			Summary: input,
+		},
+	}, nil
 }
 
 func (mh MathHandler) Query(ctx context.Context, db storage.Storage, namespace string, input string) (storage.Rows, error) {
-	return db.Query(ctx, namespace, storage.Kind("help"))
+	return queryKind(ctx, db, namespace, "math", input)
+}
+
+// BeforeSave stores the result with the expression, and the value of
+// variables so that they can be used later.
+func (mh MathHandler) BeforeSave(ctx context.Context, db storage.Storage, row *storage.Row) error {
+	name, expr, isAssignment := parseAssignment(row.Summary)
+
+	if mh.useQalc(ctx) {
+		if isAssignment {
+			return fmt.Errorf("variables need the builtin calculator, see `setting math builtin`")
+		}
+
+		result, err := qalc(ctx, row.Summary)
+		if err != nil {
+			return err
+		}
+		row.Content = sql.NullString{String: result, Valid: true}
+		return nil
+	}
+
+	settings := SettingsFrom(ctx)
+	q, err := calculate(expr, settings, currencies(settings.Rates()))
+	if err != nil {
+		return err
+	}
+	row.Content = sql.NullString{String: q.String(), Valid: true}
+
+	if isAssignment {
+		if row.Fields == nil {
+			row.Fields = make(map[string]any, 2)
+		}
+		row.Fields["var"] = name
+		row.Fields["value"] = q.expr()
+	}
+
+	return nil
 }
 
 func (mh MathHandler) Render(ctx context.Context, row *storage.Row) (Renderer, error) {
-	cmd := exec.CommandContext(ctx, "qalc", "--terse", "--color=0", row.Summary)
+	math := Math{Row: row}
+
+	// previews are calculated, saved things have their result already
+	if !row.Content.Valid {
+		_, expr, _ := parseAssignment(row.Summary)
+
+		var err error
+		if mh.useQalc(ctx) {
+			math.result, err = qalc(ctx, expr)
+		} else {
+			math.result, err = Calculate(expr, SettingsFrom(ctx))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return TemplateRenderer{Template: mathTemplate, Data: math}, nil
+}
+
+func (mh MathHandler) useQalc(ctx context.Context) bool {
+	switch SettingsFrom(ctx)["math"] {
+	case "qalc":
+		return true
+	case "builtin":
+		return false
+	}
+	return mh.Qalc
+}
+
+func qalc(ctx context.Context, expr string) (string, error) {
+	cmd := exec.CommandContext(ctx, "qalc", "--terse", "--color=0", expr)
 
 	buf := new(bytes.Buffer)
 	cmd.Stderr = buf
@@ -37,19 +133,49 @@ func (mh MathHandler) Render(ctx context.Context, row *storage.Row) (Renderer, e
 
 	err := cmd.Run()
 	if err != nil {
-		return nil, fmt.Errorf("%s", buf.String())
+		return "", fmt.Errorf("%s", buf.String())
 	}
 
-	return StringRenderer(buf.String()), nil
+	return strings.TrimSpace(buf.String()), nil
 }
 
-type Math string
+// parseAssignment splits `x = 30usd to eur` into the name of the variable
+// and the expression.  Anything else is just an expression.
+func parseAssignment(input string) (name string, expr string, ok bool) {
+	m := assignmentRe.FindStringSubmatch(input)
+	if m == nil {
+		return "", input, false
+	}
+	return m[1], m[2], true
+}
 
-func (m Math) ToRow() *storage.Row {
-	return &storage.Row{
-		Metadata: storage.Metadata{
-			Kind: "math",
-		},
-		Summary: string(m),
+type Math struct {
+	*storage.Row
+
+	result string
+}
+
+func (m Math) ToRow() *storage.Row { return m.Row }
+
+func (m Math) Result() string {
+	if m.Content.Valid {
+		return m.Content.String
 	}
+	return m.result
 }
+
+// Variable is the name of the variable the result is assigned to, if any.
+func (m Math) Variable() string {
+	name, _ := m.Fields["var"].(string)
+	if name == "" {
+		name, _, _ = parseAssignment(m.Summary)
+	}
+	return name
+}
+
+var mathTemplate = template.Must(template.Must(commonTemplates.Clone()).Parse(`
+{{ define "content" }}
+<code class="expression">{{ .Summary }}</code>
+<p class="result">{{ with .Variable }}<var>{{ . }}</var> = {{ end }}<strong>{{ .Result }}</strong></p>
+{{ end }}
+`))
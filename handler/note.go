@@ -19,7 +19,7 @@ func (nh NoteHandler) CanHandle(input string) (string, bool) {
 
 var urlRe = regexp.MustCompile(`(\w+)://[^ ]+`)
 
-func (nh NoteHandler) Parse(input string) (Thing, error) {
+func (nh NoteHandler) Parse(ctx context.Context, input string) (Thing, error) {
 	idx := strings.Index(input, " ")
 	if idx == -1 {
 		idx = len(input)
@@ -45,11 +45,7 @@ func (nh NoteHandler) Parse(input string) (Thing, error) {
 }
 
 func (nh NoteHandler) Query(ctx context.Context, db storage.Storage, namespace string, input string) (storage.Rows, error) {
-	parts := strings.SplitN(input, " ", 2)
-	if len(parts) == 1 {
-		return db.Query(ctx, namespace, storage.Kind("note"))
-	}
-	return db.Query(ctx, namespace, storage.Kind("note"), storage.Match("summary", parts[1]))
+	return queryKind(ctx, db, namespace, "note", input)
 }
 
 func (nh NoteHandler) Render(ctx context.Context, row *storage.Row) (Renderer, error) {
@@ -16,13 +16,13 @@ func (mh OverviewHandler) CanHandle(input string) (string, bool) {
 	return "overview", strings.HasPrefix(input, "overview")
 }
 
-func (mh OverviewHandler) Parse(input string) (Thing, error) {
+func (mh OverviewHandler) Parse(ctx context.Context, input string) (Thing, error) {
 	return Overview(input), nil
 }
 
 func (mh OverviewHandler) Query(ctx context.Context, db storage.Storage, namespace string, input string) (storage.Rows, error) {
 	views := []string{
-		time.Now().Format(time.DateOnly),
+		Now(ctx).Format(time.DateOnly),
 		"reminders",
 		"help",
 	}
@@ -38,6 +38,7 @@ type overviewRows struct {
 }
 
 func (o *overviewRows) Close() error { return nil }
+func (o *overviewRows) Err() error   { return nil }
 func (o *overviewRows) Next() bool   { return o.idx < 1 }
 
 func (o *overviewRows) Scan(row *storage.Row) error {
@@ -59,7 +60,7 @@ func (mh OverviewHandler) Render(ctx context.Context, row *storage.Row) (Rendere
 	renderers := make([]Renderer, 0, len(views))
 	for _, view := range views {
 		_, handler := All.For(view)
-		thing, err := handler.Parse(view)
+		thing, err := handler.Parse(ctx, view)
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/heyLu/lp/go/things/storage"
+)
+
+// queryFields maps the field names usable in queries like `number>3` to
+// their columns.
+var queryFields = map[string]string{
+	"id":       "id",
+	"number":   "number",
+	"float":    "float",
+	"time":     "time",
+	"created":  "date_created",
+	"modified": "date_modified",
+}
+
+var queryOps = []struct {
+	op   string
+	cond func(field string, val any) storage.Condition
+}{
+	// two-character operators first so that `>=` is not parsed as `>`
+	{">=", storage.Ge},
+	{"<=", storage.Le},
+	{"!=", func(field string, val any) storage.Condition { return storage.Not(storage.Eq(field, val)) }},
+	{">", storage.Gt},
+	{"<", storage.Lt},
+	{"=", storage.Eq},
+}
+
+// ParseQuery splits a query like `kind:task tag:#work after:2024-08 is:done
+// number>3 -tag:#old bike` into free text terms and conditions.
+//
+// Supported filters are kind:, tag:, summary:, content:, ref:, is:done,
+// is:open and is:archived, after: and before: (by date created), and comparisons on the
+// fields in queryFields.  Prefixing a filter or term with - negates it.
+// Dates are in the location of ctx.
+func ParseQuery(ctx context.Context, query string) (string, []storage.Condition, error) {
+	return parseQuery(ctx, query, true)
+}
+
+// parseKindQuery is like [ParseQuery], but keeps filters it doesn't know or
+// can't parse as free text terms, because lists of a kind are shown while
+// typing, e.g. for `task after:lunch`.
+func parseKindQuery(ctx context.Context, query string) (string, []storage.Condition) {
+	terms, conditions, _ := parseQuery(ctx, query, false)
+	return terms, conditions
+}
+
+func parseQuery(ctx context.Context, query string, strict bool) (string, []storage.Condition, error) {
+	terms := make([]string, 0, 2)
+	conditions := make([]storage.Condition, 0, 2)
+
+	for _, word := range strings.Fields(query) {
+		negate := false
+		if len(word) > 1 && word[0] == '-' {
+			negate = true
+			word = word[1:]
+		}
+
+		condition, ok, err := parseQueryWord(word, Location(ctx))
+		if err != nil && strict {
+			return "", nil, err
+		}
+
+		if !ok {
+			if negate {
+				conditions = append(conditions, storage.Not(storage.Match("summary", word)))
+				continue
+			}
+
+			terms = append(terms, word)
+			continue
+		}
+
+		if negate {
+			condition = storage.Not(condition)
+		}
+		conditions = append(conditions, condition)
+	}
+
+	return strings.Join(terms, " "), conditions, nil
+}
+
+func parseQueryWord(word string, loc *time.Location) (storage.Condition, bool, error) {
+	if key, val, ok := strings.Cut(word, ":"); ok && val != "" {
+		switch key {
+		case "kind":
+			return storage.Kind(val), true, nil
+		case "tag":
+			if val[0] != '#' {
+				val = "#" + val
+			}
+			return storage.Tag(val), true, nil
+		case "summary", "content", "ref":
+			return storage.Match(key, val), true, nil
+		case "is":
+			switch val {
+			case "done":
+				return storage.Is("bool", true), true, nil
+			case "open":
+				return storage.Not(storage.Is("bool", true)), true, nil
+			case "archived":
+				return storage.Field("archived", true), true, nil
+			default:
+				return storage.Condition{}, false, fmt.Errorf("unknown is:%s, try is:done, is:open or is:archived", val)
+			}
+		case "after", "before":
+			t, err := parseQueryTime(val, loc)
+			if err != nil {
+				return storage.Condition{}, false, err
+			}
+			if key == "after" {
+				return storage.Ge("date_created", t.Unix()), true, nil
+			}
+			return storage.Lt("date_created", t.Unix()), true, nil
+		}
+	}
+
+	for _, op := range queryOps {
+		key, val, ok := strings.Cut(word, op.op)
+		if !ok {
+			continue
+		}
+
+		field, ok := queryFields[key]
+		if !ok {
+			return storage.Condition{}, false, nil
+		}
+
+		if val == "" {
+			return storage.Condition{}, false, fmt.Errorf("missing value in %q", word)
+		}
+
+		switch field {
+		case "time", "date_created", "date_modified":
+			t, err := parseQueryTime(val, loc)
+			if err != nil {
+				return storage.Condition{}, false, err
+			}
+			return op.cond(field, t.Unix()), true, nil
+		default:
+			num, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				return storage.Condition{}, false, fmt.Errorf("invalid number in %q: %w", word, err)
+			}
+			return op.cond(field, num), true, nil
+		}
+	}
+
+	return storage.Condition{}, false, nil
+}
+
+// parseQueryTime parses dates in the formats supported by [ByDateHandler].
+func parseQueryTime(val string, loc *time.Location) (time.Time, error) {
+	for _, format := range byDateFormats {
+		t, err := time.ParseInLocation(format, val, loc)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("can't parse date %q, try e.g. 2024-08-15", val)
+}
+
+// queryKind queries things of kind, using everything after the first word of
+// input as a query for [parseKindQuery].
+func queryKind(ctx context.Context, db storage.Storage, namespace string, kind string, input string) (storage.Rows, error) {
+	_, query, _ := strings.Cut(input, " ")
+	terms, conditions := parseKindQuery(ctx, query)
+	return db.Search(ctx, namespace, terms, append([]storage.Condition{storage.Kind(kind)}, conditions...)...)
+}
+
+// doneConditions returns conditions for listing open things, unless query
+// starts with done (e.g. `task done`) for things that are done but not
+// archived yet, or `all` for everything.  It returns the rest of the query.
+func doneConditions(query string, done string) (string, []storage.Condition) {
+	first, rest, _ := strings.Cut(query, " ")
+	switch first {
+	case done:
+		return rest, []storage.Condition{storage.Is("bool", true), storage.Not(storage.Field("archived", true))}
+	case "all":
+		return rest, nil
+	}
+	return query, []storage.Condition{storage.Not(storage.Is("bool", true))}
+}
@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/heyLu/lp/go/things/storage"
+)
+
+func TestParseQuery(t *testing.T) {
+	terms, conditions, err := ParseQuery(WithLocation(context.Background(), time.UTC), "kind:task tag:work after:2024-08 is:done number>=3 -tag:#old fix bike")
+	require.NoError(t, err)
+	require.Equal(t, "fix bike", terms)
+
+	require.Equal(t, []storage.Condition{
+		storage.Kind("task"),
+		storage.Tag("#work"),
+		storage.Ge("date_created", time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC).Unix()),
+		storage.Is("bool", true),
+		storage.Ge("number", 3.0),
+		storage.Not(storage.Tag("#old")),
+	}, conditions)
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, query := range []string{"is:maybe", "after:yesterday", "number>", "float<abc"} {
+		_, _, err := ParseQuery(context.Background(), query)
+		require.Error(t, err, query)
+	}
+
+	terms, conditions := parseKindQuery(context.Background(), "is:urgent call -after:lunch bob is:done")
+	require.Equal(t, "is:urgent call bob", terms)
+	require.Equal(t, []storage.Condition{
+		storage.Not(storage.Match("summary", "after:lunch")),
+		storage.Is("bool", true),
+	}, conditions)
+}
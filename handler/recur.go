@@ -0,0 +1,253 @@
+package handler
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/heyLu/lp/go/things/storage"
+)
+
+// Recurrence is how often a reminder or task repeats, parsed from rules like
+// `daily 22:00`, `every monday 9:00` or `every 2w`.
+//
+// The rule is stored as written in Fields["recur"].
+type Recurrence struct {
+	Every int
+	Unit  string // one of "h", "d", "w" or "mo"
+
+	// Weekday is set for rules like `every monday`
+	Weekday *time.Weekday
+	// At is the time of day for rules like `daily 22:00`, nil if not given
+	At *time.Duration
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "sun": time.Sunday,
+	"monday": time.Monday, "mon": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday,
+	"thursday": time.Thursday, "thu": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday,
+	"saturday": time.Saturday, "sat": time.Saturday,
+}
+
+var (
+	everyRe     = regexp.MustCompile(`^(\d+)(h|d|w|mo)$`)
+	timeOfDayRe = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(am|pm)?$`)
+)
+
+var recurUnits = map[string]string{
+	"hour": "h", "hours": "h",
+	"day": "d", "days": "d",
+	"week": "w", "weeks": "w",
+	"month": "mo", "months": "mo",
+}
+
+// ParseRecurrence parses a recurrence rule at the start of words, returning
+// the number of words it used.  It returns 0 and no error if words does not
+// start with a rule.
+func ParseRecurrence(words []string) (Recurrence, int, error) {
+	if len(words) == 0 {
+		return Recurrence{}, 0, nil
+	}
+
+	r := Recurrence{Every: 1}
+	n := 1
+	switch strings.ToLower(words[0]) {
+	case "hourly":
+		r.Unit = "h"
+	case "daily":
+		r.Unit = "d"
+	case "weekly":
+		r.Unit = "w"
+	case "monthly":
+		r.Unit = "mo"
+	case "every":
+		if len(words) < 2 {
+			return r, 0, fmt.Errorf("usage: every <monday|day|2w|...> [time]")
+		}
+
+		word := strings.ToLower(words[1])
+		n = 2
+		if weekday, ok := weekdays[word]; ok {
+			r.Unit = "w"
+			r.Weekday = &weekday
+		} else if unit, ok := recurUnits[word]; ok {
+			r.Unit = unit
+		} else if m := everyRe.FindStringSubmatch(word); m != nil {
+			r.Every, _ = strconv.Atoi(m[1])
+			r.Unit = m[2]
+		} else if every, err := strconv.Atoi(word); err == nil && len(words) > 2 && recurUnits[strings.ToLower(words[2])] != "" {
+			r.Every = every
+			r.Unit = recurUnits[strings.ToLower(words[2])]
+			n = 3
+		} else {
+			return r, 0, fmt.Errorf("unknown recurrence %q, try e.g. `every monday` or `every 2w`", words[1])
+		}
+
+		if r.Every <= 0 {
+			return r, 0, fmt.Errorf("recurrence must be at least every 1%s", r.Unit)
+		}
+	default:
+		return r, 0, nil
+	}
+
+	if len(words) > n && r.Unit != "h" {
+		at, ok := parseTimeOfDay(words[n])
+		if ok {
+			r.At = &at
+			n++
+		}
+	}
+
+	return r, n, nil
+}
+
+// parseTimeOfDay parses times like `9:00`, `22:30`, `9am` or `7:15pm`.
+func parseTimeOfDay(word string) (time.Duration, bool) {
+	m := timeOfDayRe.FindStringSubmatch(strings.ToLower(word))
+	if m == nil || (m[2] == "" && m[3] == "") {
+		return 0, false
+	}
+
+	hours, _ := strconv.Atoi(m[1])
+	minutes := 0
+	if m[2] != "" {
+		minutes, _ = strconv.Atoi(m[2])
+	}
+
+	if m[3] != "" && (hours == 0 || hours > 12) {
+		return 0, false
+	}
+
+	switch m[3] {
+	case "am":
+		if hours == 12 {
+			hours = 0
+		}
+	case "pm":
+		if hours < 12 {
+			hours += 12
+		}
+	}
+
+	if hours > 23 || minutes > 59 {
+		return 0, false
+	}
+
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, true
+}
+
+func (r Recurrence) step(t time.Time) time.Time {
+	switch r.Unit {
+	case "h":
+		return t.Add(time.Duration(r.Every) * time.Hour)
+	case "d":
+		return t.AddDate(0, 0, r.Every)
+	case "w":
+		return t.AddDate(0, 0, 7*r.Every)
+	case "mo":
+		return t.AddDate(0, r.Every, 0)
+	}
+	panic("unknown recurrence unit " + r.Unit)
+}
+
+func (r Recurrence) atTimeOfDay(t time.Time) time.Time {
+	if r.At == nil {
+		return t
+	}
+
+	return atTimeOfDay(t, *r.At)
+}
+
+// First returns the first occurrence at or after now, in the location of now.
+func (r Recurrence) First(now time.Time) time.Time {
+	now = now.Truncate(time.Minute)
+	if r.At == nil && r.Weekday == nil {
+		return r.step(now)
+	}
+
+	first := r.atTimeOfDay(now)
+	for first.Before(now) || (r.Weekday != nil && first.Weekday() != *r.Weekday) {
+		first = r.atTimeOfDay(first.AddDate(0, 0, 1))
+	}
+	return first
+}
+
+// Next returns the first occurrence after prev that is after now as well, so
+// that occurrences missed while nobody was looking are skipped.
+func (r Recurrence) Next(prev time.Time, now time.Time) time.Time {
+	next := r.atTimeOfDay(r.step(prev))
+	for !next.After(now) {
+		next = r.atTimeOfDay(r.step(next))
+	}
+	return next
+}
+
+// rowRecurrence returns the recurrence of row, if it has one.
+func rowRecurrence(row *storage.Row) (Recurrence, bool, error) {
+	rule, _ := row.Fields["recur"].(string)
+	if rule == "" {
+		return Recurrence{}, false, nil
+	}
+
+	r, n, err := ParseRecurrence(strings.Fields(rule))
+	if err != nil {
+		return r, false, err
+	}
+	return r, n > 0, nil
+}
+
+// NextOccurrence returns a new thing for the next occurrence of a repeating
+// reminder or task, or nil if row does not repeat.
+//
+// Occurrences follow the due time of row, or now if it has none.
+func NextOccurrence(row *storage.Row, now time.Time) (*storage.Row, error) {
+	r, ok, err := rowRecurrence(row)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	prev := now.Truncate(time.Minute)
+	if row.Time.Valid {
+		prev = row.Time.Time
+	}
+
+	next := &storage.Row{
+		Metadata: storage.Metadata{
+			Namespace: row.Namespace,
+			Kind:      row.Kind,
+			Tags:      row.Tags,
+		},
+		Summary: row.Summary,
+		Content: row.Content,
+		Ref:     row.Ref,
+		Number:  row.Number,
+		Float:   row.Float,
+		Fields:  maps.Clone(row.Fields),
+	}
+	delete(next.Fields, "next_id")
+	next.Bool.Valid = true
+	next.Time.Time = r.Next(prev.In(now.Location()), now).UTC()
+	next.Time.Valid = true
+
+	return next, nil
+}
+
+// cutWords splits off the first n words of s, returning the rest with its
+// spacing intact.
+func cutWords(s string, n int) string {
+	for range n {
+		s = strings.TrimLeft(s, " ")
+		idx := strings.Index(s, " ")
+		if idx == -1 {
+			return ""
+		}
+		s = s[idx:]
+	}
+	return strings.TrimSpace(s)
+}
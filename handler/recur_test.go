@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/heyLu/lp/go/things/storage"
+)
+
+func TestRecurrence(t *testing.T) {
+	// a saturday
+	now := time.Date(2024, 8, 31, 10, 30, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		rule  string
+		first time.Time
+		next  time.Time
+	}{
+		{"daily 22:00", time.Date(2024, 8, 31, 22, 0, 0, 0, time.UTC), time.Date(2024, 9, 1, 22, 0, 0, 0, time.UTC)},
+		{"daily 9am", time.Date(2024, 9, 1, 9, 0, 0, 0, time.UTC), time.Date(2024, 9, 2, 9, 0, 0, 0, time.UTC)},
+		{"every monday 9:00", time.Date(2024, 9, 2, 9, 0, 0, 0, time.UTC), time.Date(2024, 9, 9, 9, 0, 0, 0, time.UTC)},
+		{"every 2w", time.Date(2024, 9, 14, 10, 30, 0, 0, time.UTC), time.Date(2024, 9, 28, 10, 30, 0, 0, time.UTC)},
+		{"every 3 days", time.Date(2024, 9, 3, 10, 30, 0, 0, time.UTC), time.Date(2024, 9, 6, 10, 30, 0, 0, time.UTC)},
+		{"every 2h", time.Date(2024, 8, 31, 12, 30, 0, 0, time.UTC), time.Date(2024, 8, 31, 14, 30, 0, 0, time.UTC)},
+		{"monthly 7:15pm", time.Date(2024, 8, 31, 19, 15, 0, 0, time.UTC), time.Date(2024, 10, 1, 19, 15, 0, 0, time.UTC)},
+	} {
+		r, n, err := ParseRecurrence(append(strings.Fields(tc.rule), "standup"))
+		require.NoError(t, err, tc.rule)
+		require.Equal(t, len(strings.Fields(tc.rule)), n, tc.rule)
+
+		first := r.First(now)
+		require.Equal(t, tc.first, first, tc.rule)
+		require.Equal(t, tc.next, r.Next(first, first), tc.rule)
+	}
+
+	_, n, err := ParseRecurrence([]string{"call", "them"})
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	_, _, err = ParseRecurrence([]string{"every", "blue", "moon"})
+	require.Error(t, err)
+}
+
+func TestNextOccurrence(t *testing.T) {
+	now := time.Date(2024, 9, 10, 8, 0, 0, 0, time.UTC)
+
+	row := &storage.Row{
+		Metadata: storage.Metadata{Namespace: "test", Kind: "reminder", ID: 1},
+		Summary:  "standup",
+		Bool:     sql.NullBool{Bool: true, Valid: true},
+		Time:     sql.NullTime{Time: time.Date(2024, 9, 2, 9, 0, 0, 0, time.UTC), Valid: true},
+		Fields:   map[string]any{"recur": "every monday 9:00"},
+	}
+
+	next, err := NextOccurrence(row, now)
+	require.NoError(t, err)
+	require.Equal(t, "standup", next.Summary)
+	require.Zero(t, next.ID)
+	require.False(t, next.Bool.Bool)
+	// missed occurrences are skipped
+	require.Equal(t, time.Date(2024, 9, 16, 9, 0, 0, 0, time.UTC), next.Time.Time)
+
+	row.Fields = nil
+	next, err = NextOccurrence(row, now)
+	require.NoError(t, err)
+	require.Nil(t, next)
+}
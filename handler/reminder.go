@@ -2,7 +2,10 @@ package handler
 
 import (
 	"context"
+	"fmt"
 	"html/template"
+	"net/url"
+	"slices"
 	"strings"
 	"time"
 
@@ -10,15 +13,29 @@ import (
 )
 
 var _ Handler = ReminderHandler{}
+var _ Editor = ReminderHandler{}
+var _ Grouper = ReminderHandler{}
 var _ Thing = &Reminder{}
 
+// The states of a reminder: pending until it is due, overdue until the
+// scheduler has fired it, fired until someone dismisses it.
+const (
+	ReminderPending   = "pending"
+	ReminderOverdue   = "overdue"
+	ReminderFired     = "fired"
+	ReminderDismissed = "dismissed"
+)
+
+// reminderStates are in the order reminders are listed in.
+var reminderStates = []string{ReminderOverdue, ReminderFired, ReminderPending, ReminderDismissed}
+
 type ReminderHandler struct{}
 
 func (rh ReminderHandler) CanHandle(input string) (string, bool) {
 	return "reminder", strings.HasPrefix(input, "remind")
 }
 
-func (rh ReminderHandler) Parse(input string) (Thing, error) {
+func (rh ReminderHandler) Parse(ctx context.Context, input string) (Thing, error) {
 	reminder := Reminder{
 		Row: &storage.Row{
 			Metadata: storage.Metadata{
@@ -29,53 +46,198 @@ func (rh ReminderHandler) Parse(input string) (Thing, error) {
 
 	reminder.Bool.Bool = false
 
-	parts := strings.SplitN(input, " ", 3)
+	words := strings.Fields(input)
+	if len(words) < 2 {
+		return &reminder, nil
+	}
 
-	var dur time.Duration
-	var err error
-	if len(parts) > 1 {
-		dur, err = time.ParseDuration(parts[1])
-		if err != nil {
-			return nil, err
-		}
+	r, n, err := ParseRecurrence(words[1:])
+	if err != nil {
+		return nil, err
+	}
 
-		reminder.Time.Time = time.Now().UTC().Add(dur).Truncate(time.Minute)
+	if n > 0 {
+		reminder.Fields = map[string]any{"recur": strings.Join(words[1:1+n], " ")}
+		reminder.Time.Time = r.First(Now(ctx)).UTC()
 		reminder.Time.Valid = true
+		reminder.Summary = cutWords(input, 1+n)
+		return &reminder, nil
 	}
 
-	if len(parts) > 2 {
-		reminder.Summary = parts[2]
+	due, n, err := ParseWhen(words[1:], Now(ctx))
+	if err != nil {
+		return nil, err
 	}
 
+	reminder.Time.Time = due.UTC()
+	reminder.Time.Valid = true
+	reminder.Summary = cutWords(input, 1+n)
+
 	return &reminder, nil
 }
 
+// Query lists reminders by state and then by due time, overdue ones first.
 func (rh ReminderHandler) Query(ctx context.Context, db storage.Storage, namespace string, input string) (storage.Rows, error) {
-	if !strings.Contains(input, " ") {
-		return db.Query(ctx, namespace, storage.Kind("reminder"))
+	rows, err := queryKind(ctx, db, namespace, "reminder", input)
+	if err != nil {
+		return nil, err
+	}
+
+	reminders, err := collectRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	now := Now(ctx)
+	slices.SortStableFunc(reminders, func(a, b *storage.Row) int {
+		stateA, stateB := Reminder{Row: a}.State(now), Reminder{Row: b}.State(now)
+		if stateA != stateB {
+			return slices.Index(reminderStates, stateA) - slices.Index(reminderStates, stateB)
+		}
+
+		if stateA == ReminderDismissed {
+			return b.Time.Time.Compare(a.Time.Time)
+		}
+		return a.Time.Time.Compare(b.Time.Time)
+	})
+
+	return &sliceRows{rows: reminders}, nil
+}
+
+func (rh ReminderHandler) Group(ctx context.Context, row *storage.Row) string {
+	return Reminder{Row: row}.State(Now(ctx))
+}
+
+// Edit dismisses reminders with `dismiss=true` and snoozes them with
+// `snooze=<when>`, e.g. `10m` or `tomorrow`.
+func (rh ReminderHandler) Edit(ctx context.Context, row *storage.Row, form url.Values) error {
+	if form.Get("dismiss") == "true" {
+		if row.Fields == nil {
+			row.Fields = make(map[string]any, 1)
+		}
+		row.Fields["state"] = ReminderDismissed
+		// so that the scheduler leaves it alone
+		row.Bool.Bool = true
+		row.Bool.Valid = true
+		return nil
+	}
+
+	if snooze := form.Get("snooze"); snooze != "" {
+		words := strings.Fields(snooze)
+		due, n, err := ParseWhen(words, Now(ctx))
+		if err != nil {
+			return err
+		}
+		if n != len(words) {
+			return fmt.Errorf("don't know when %q is", snooze)
+		}
+
+		if row.Bool.Bool {
+			// the next occurrence was added when this one fired
+			delete(row.Fields, "recur")
+		}
+		delete(row.Fields, "state")
+		row.Time.Time = due.UTC()
+		row.Time.Valid = true
+		row.Bool.Bool = false
+		row.Bool.Valid = true
 	}
-	return db.Query(ctx, namespace, storage.Kind("reminder"), storage.Match("summary", input))
+
+	return nil
 }
 
 func (rh ReminderHandler) Render(ctx context.Context, row *storage.Row) (Renderer, error) {
-	return TemplateRenderer{Template: reminderTemplate, Data: Reminder{Row: row}}, nil
+	return TemplateRenderer{Template: reminderTemplate, Data: Reminder{Row: row, now: Now(ctx)}}, nil
 }
 
-type Reminder struct{ *storage.Row }
+type Reminder struct {
+	*storage.Row
+
+	// now is when the reminder is rendered, see [Reminder.CurrentState]
+	now time.Time
+}
 
 func (r *Reminder) ToRow() *storage.Row {
 	return r.Row
 }
 
-func (r Reminder) Until() time.Duration {
-	return r.Time.Time.Sub(time.Now()).Truncate(time.Minute)
+// Recur is the recurrence rule of the reminder, if it repeats.
+func (r Reminder) Recur() string {
+	rule, _ := r.Fields["recur"].(string)
+	return rule
+}
+
+func (r Reminder) State(now time.Time) string {
+	switch {
+	case r.Fields["state"] == ReminderDismissed:
+		return ReminderDismissed
+	case r.Bool.Bool:
+		return ReminderFired
+	case r.Time.Valid && !r.Time.Time.After(now):
+		return ReminderOverdue
+	default:
+		return ReminderPending
+	}
+}
+
+func (r Reminder) CurrentState() string { return r.State(r.now) }
+
+// Due is when the reminder is due relative to now, e.g. `in 2h 5m` or
+// `3d 2h ago`.
+func (r Reminder) Due() string {
+	until := r.Time.Time.Sub(r.now)
+	if until < 0 {
+		return formatDuration(-until) + " ago"
+	}
+	return "in " + formatDuration(until)
+}
+
+// formatDuration formats d with at most two units, e.g. `3d 2h` or `5m`.
+func formatDuration(d time.Duration) string {
+	units := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"d", 24 * time.Hour},
+		{"h", time.Hour},
+		{"m", time.Minute},
+	}
+
+	parts := make([]string, 0, 2)
+	for _, unit := range units {
+		if d >= unit.d {
+			parts = append(parts, fmt.Sprintf("%d%s", d/unit.d, unit.name))
+			d %= unit.d
+		}
+		if len(parts) == 2 || (len(parts) == 1 && d < time.Minute) {
+			break
+		}
+	}
+
+	if len(parts) == 0 {
+		return "<1m"
+	}
+	return strings.Join(parts, " ")
 }
 
 var reminderTemplate = template.Must(template.Must(commonTemplates.Clone()).Parse(`
 {{ define "content" }}
-<span>
-	<time time="{{ .Time }}" title="{{ .Time }}">in {{ .Until }}</time>
+{{ $state := .CurrentState }}
+<span class="reminder reminder-{{ $state }}">
+	<time datetime="{{ .Time.Time.Format "2006-01-02T15:04:05Z07:00" }}" title="{{ (local .Time.Time).Format "Mon, 02 Jan 2006 15:04" }}">{{ .Due }}</time>
+	{{ if eq .ID 0 }}<span class="due">({{ (local .Time.Time).Format "Mon, 02 Jan 2006 15:04" }})</span>{{ end }}
 	{{ .Summary }}
+	{{ if .Recur }}<span class="recur" title="repeats">↻ {{ .Recur }}</span>{{ end }}
+	{{ if and (gt .ID 0) (ne $state "pending") }}<span class="state">{{ $state }}</span>{{ end }}
 </span>
+{{ if and (gt .ID 0) (ne $state "dismissed") }}
+<form class="reminder-actions" method="POST" action="/{{ .Namespace }}/{{ .Kind }}/{{ .ID }}"
+	hx-post="/{{ .Namespace }}/{{ .Kind }}/{{ .ID }}" hx-target="closest section.thing" hx-swap="outerHTML">
+	<button name="snooze" value="10m">+10m</button>
+	<button name="snooze" value="1h">+1h</button>
+	<button name="snooze" value="tomorrow">tomorrow</button>
+	<button name="dismiss" value="true">dismiss</button>
+</form>
+{{ end }}
 {{ end }}
 `))
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/heyLu/lp/go/things/storage"
+)
+
+func TestReminderStates(t *testing.T) {
+	now := time.Now()
+
+	row := &storage.Row{
+		Metadata: storage.Metadata{Namespace: "test", Kind: "reminder", ID: 1},
+		Summary:  "call bank",
+		Time:     sql.NullTime{Time: now.Add(time.Hour), Valid: true},
+	}
+	require.Equal(t, ReminderPending, Reminder{Row: row}.State(now))
+	require.Equal(t, ReminderOverdue, Reminder{Row: row}.State(now.Add(2*time.Hour)))
+
+	row.Bool = sql.NullBool{Bool: true, Valid: true}
+	require.Equal(t, ReminderFired, Reminder{Row: row}.State(now.Add(2*time.Hour)))
+
+	rh := ReminderHandler{}
+	require.NoError(t, rh.Edit(context.Background(), row, url.Values{}))
+	require.Nil(t, row.Fields)
+
+	require.NoError(t, rh.Edit(context.Background(), row, url.Values{"snooze": {"10m"}}))
+	require.Equal(t, ReminderPending, Reminder{Row: row}.State(now))
+	require.WithinDuration(t, now.Add(10*time.Minute), row.Time.Time, time.Minute)
+
+	require.NoError(t, rh.Edit(context.Background(), row, url.Values{"dismiss": {"true"}}))
+	require.Equal(t, ReminderDismissed, Reminder{Row: row}.State(now))
+	require.True(t, row.Bool.Bool)
+
+	require.Error(t, rh.Edit(context.Background(), row, url.Values{"snooze": {"10m later"}}))
+}
+
+func TestFormatDuration(t *testing.T) {
+	require.Equal(t, "<1m", formatDuration(30*time.Second))
+	require.Equal(t, "5m", formatDuration(5*time.Minute+10*time.Second))
+	require.Equal(t, "2h 5m", formatDuration(2*time.Hour+5*time.Minute))
+	require.Equal(t, "3h", formatDuration(3*time.Hour+30*time.Second))
+	require.Equal(t, "3d 2h", formatDuration(3*24*time.Hour+2*time.Hour+7*time.Minute))
+}
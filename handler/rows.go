@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"github.com/heyLu/lp/go/things/storage"
+)
+
+// sliceRows are rows that were read into memory already, e.g. to sort them
+// differently than storage does.
+type sliceRows struct {
+	idx  int
+	rows []*storage.Row
+}
+
+func (sr *sliceRows) Close() error { return nil }
+func (sr *sliceRows) Err() error   { return nil }
+func (sr *sliceRows) Next() bool   { return sr.idx < len(sr.rows) }
+
+func (sr *sliceRows) Scan(row *storage.Row) error {
+	*row = *sr.rows[sr.idx]
+	sr.idx += 1
+	return nil
+}
+
+// collectRows reads all of rows and closes them.
+func collectRows(rows storage.Rows) ([]*storage.Row, error) {
+	all := make([]*storage.Row, 0, 10)
+	for rows.Next() {
+		var row storage.Row
+		err := rows.Scan(&row)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		all = append(all, &row)
+	}
+
+	return all, rows.Close()
+}
@@ -2,6 +2,8 @@ package handler
 
 import (
 	"context"
+	"fmt"
+	"html"
 	"strings"
 
 	"github.com/heyLu/lp/go/things/storage"
@@ -15,13 +17,16 @@ func (s SearchHandler) CanHandle(input string) (string, bool) {
 	return "search", input == "" || strings.HasPrefix(input, "search")
 }
 
-func (s SearchHandler) Parse(input string) (Thing, error) {
+func (s SearchHandler) Parse(ctx context.Context, input string) (Thing, error) {
 	return Search(input), nil
 }
 
 func (s SearchHandler) Query(ctx context.Context, db storage.Storage, namespace string, input string) (storage.Rows, error) {
-	// TODO: implement actual search :)
-	return db.Query(ctx, namespace)
+	terms, conditions, err := ParseQuery(ctx, strings.TrimPrefix(input, "search"))
+	if err != nil {
+		return nil, err
+	}
+	return db.Search(ctx, namespace, terms, conditions...)
 }
 
 func (s SearchHandler) Render(ctx context.Context, row *storage.Row) (Renderer, error) {
@@ -30,8 +35,28 @@ func (s SearchHandler) Render(ctx context.Context, row *storage.Row) (Renderer,
 	}
 
 	_, handler := All.For(row.Kind)
+	if handler == nil {
+		return nil, fmt.Errorf("no handler for %q", row.Kind)
+	}
+
+	renderer, err := handler.Render(ctx, row)
+	if err != nil {
+		return nil, err
+	}
+
+	if row.Snippet == "" {
+		return renderer, nil
+	}
+
+	return SequenceRenderer{snippetRenderer(row.Snippet), renderer}, nil
+}
 
-	return handler.Render(ctx, row)
+// snippetRenderer renders a search snippet with the matches highlighted.
+func snippetRenderer(snippet string) Renderer {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, storage.SnippetStart, "<mark>")
+	snippet = strings.ReplaceAll(snippet, storage.SnippetEnd, "</mark>")
+	return HTMLRenderer(`<div class="snippet">` + snippet + `</div>`)
 }
 
 type Search string
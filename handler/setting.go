@@ -5,7 +5,10 @@ import (
 	"database/sql"
 	"fmt"
 	"html/template"
+	"os/exec"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/heyLu/lp/go/things/storage"
 )
@@ -18,12 +21,62 @@ func (s SettingHandler) CanHandle(input string) (string, bool) {
 	return "setting", strings.HasPrefix(input, "setting")
 }
 
-func (s SettingHandler) Parse(input string) (Thing, error) {
+func (s SettingHandler) Parse(ctx context.Context, input string) (Thing, error) {
 	parts := strings.SplitN(input, " ", 3)
 	if len(parts) < 3 {
 		return nil, fmt.Errorf("usage: setting <key> <value...>")
 	}
 
+	if parts[1] == "timezone" {
+		_, err := time.LoadLocation(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("unknown timezone %q, try e.g. Europe/Berlin", parts[2])
+		}
+	}
+
+	// `rate usd/eur 0.91` is stored as `rate.usd/eur` with the date
+	if parts[1] == "rate" {
+		pair, value, _ := strings.Cut(parts[2], " ")
+		parts[1], parts[2] = "rate."+pair, value
+	}
+	if strings.HasPrefix(parts[1], "rate.") {
+		rate, err := parseRateSetting(parts[1], parts[2])
+		if err != nil {
+			return nil, err
+		}
+		if rate.Date.IsZero() {
+			rate.Date = Now(ctx)
+		}
+		parts[1], parts[2] = rateSetting(rate)
+	}
+
+	if parts[1] == "archive" {
+		days, err := strconv.Atoi(parts[2])
+		if err != nil || days <= 0 {
+			return nil, fmt.Errorf("usage: setting archive <days>, to archive things done that long ago")
+		}
+	}
+
+	if parts[1] == "math" {
+		switch parts[2] {
+		case "builtin":
+		case "qalc":
+			_, err := exec.LookPath("qalc")
+			if err != nil {
+				return nil, fmt.Errorf("qalc is not installed here, use builtin")
+			}
+		default:
+			return nil, fmt.Errorf("unknown math %q, use builtin or qalc", parts[2])
+		}
+	}
+
+	if strings.HasPrefix(parts[1], "track.") {
+		_, err := ParseTrackCategory(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", parts[1], err)
+		}
+	}
+
 	return &Setting{
 		Row: &storage.Row{
 			Metadata: storage.Metadata{
@@ -46,6 +99,112 @@ func (s SettingHandler) Render(ctx context.Context, row *storage.Row) (Renderer,
 	return TemplateRenderer{Template: settingTemplate, Data: &Setting{Row: row}}, nil
 }
 
+// Settings are the settings of a namespace, by key.
+type Settings map[string]string
+
+// LoadSettings returns the settings of namespace, with the newest value of
+// each key, the variables of saved calculations as `var.<name>` and the
+// exchange rates in db as `rate.<base>/<quote>`.
+func LoadSettings(ctx context.Context, db storage.Storage, namespace string) (Settings, error) {
+	rows, err := db.Query(ctx, namespace, storage.Kind("setting"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := make(Settings, 4)
+	for rows.Next() {
+		var row storage.Row
+		err := rows.Scan(&row)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := settings[row.Summary]; !ok {
+			settings[row.Summary] = row.Content.String
+		}
+	}
+
+	// variables of saved calculations, see [MathHandler.BeforeSave]
+	err = loadVariables(ctx, db, namespace, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	// imported exchange rates, unless the namespace has its own
+	rates, err := db.Rates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, rate := range rates {
+		key, value := rateSetting(rate)
+		if _, ok := settings[key]; !ok {
+			settings[key] = value
+		}
+	}
+
+	return settings, nil
+}
+
+// loadSetting returns the newest value of the setting name in namespace,
+// without loading all of them like [LoadSettings].
+func loadSetting(ctx context.Context, db storage.Storage, namespace string, name string) (string, bool, error) {
+	rows, err := db.Query(ctx, namespace, storage.Kind("setting"), storage.Summary(name))
+	if err != nil {
+		return "", false, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return "", false, rows.Err()
+	}
+
+	var row storage.Row
+	err = rows.Scan(&row)
+	if err != nil {
+		return "", false, err
+	}
+	return row.Content.String, true, nil
+}
+
+func loadVariables(ctx context.Context, db storage.Storage, namespace string, settings Settings) error {
+	// only saved calculations that assign a variable
+	rows, err := db.Query(ctx, namespace, storage.Kind("math"), storage.Not(storage.Field("var", nil)))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row storage.Row
+		err := rows.Scan(&row)
+		if err != nil {
+			return err
+		}
+
+		name, _ := row.Fields["var"].(string)
+		value, _ := row.Fields["value"].(string)
+		if name == "" || value == "" {
+			continue
+		}
+
+		if _, ok := settings["var."+name]; !ok {
+			settings["var."+name] = value
+		}
+	}
+
+	return nil
+}
+
+// Location returns the location of the `timezone` setting, or the local one
+// of the server if there is none.
+func (s Settings) Location() (*time.Location, error) {
+	if s["timezone"] == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(s["timezone"])
+}
+
 type Setting struct {
 	*storage.Row
 }
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+
+	"github.com/heyLu/lp/go/things/storage"
+)
+
+var _ Handler = TagsHandler{}
+
+// TagsHandler lists all tags with the number of things tagged with them,
+// e.g. `tags` or `tags work` for #work and its children like #work/clientA.
+type TagsHandler struct{}
+
+func (th TagsHandler) CanHandle(input string) (string, bool) {
+	return "tags", strings.HasPrefix(input, "tags")
+}
+
+func (th TagsHandler) Parse(ctx context.Context, input string) (Thing, error) {
+	return Tags(input), nil
+}
+
+func (th TagsHandler) Query(ctx context.Context, db storage.Storage, namespace string, input string) (storage.Rows, error) {
+	counts, err := db.TagCounts(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	_, prefix, _ := strings.Cut(input, " ")
+	prefix = strings.TrimSpace(prefix)
+	if prefix != "" {
+		if prefix[0] != '#' {
+			prefix = "#" + prefix
+		}
+
+		filtered := make([]storage.TagCount, 0, len(counts))
+		for _, count := range counts {
+			if count.Tag == prefix || strings.HasPrefix(count.Tag, prefix+"/") {
+				filtered = append(filtered, count)
+			}
+		}
+		counts = filtered
+	}
+
+	return &tagRows{namespace: namespace, counts: counts}, nil
+}
+
+type tagRows struct {
+	idx       int
+	namespace string
+	counts    []storage.TagCount
+}
+
+func (tr *tagRows) Close() error { return nil }
+func (tr *tagRows) Err() error   { return nil }
+func (tr *tagRows) Next() bool   { return tr.idx < len(tr.counts) }
+
+func (tr *tagRows) Scan(row *storage.Row) error {
+	count := tr.counts[tr.idx]
+	tr.idx += 1
+
+	*row = storage.Row{
+		Metadata: storage.Metadata{
+			Namespace: tr.namespace,
+			Kind:      "tags",
+		},
+		Summary: count.Tag,
+		Number:  sql.NullInt64{Int64: int64(count.Count), Valid: true},
+	}
+
+	return nil
+}
+
+func (th TagsHandler) Render(ctx context.Context, row *storage.Row) (Renderer, error) {
+	if row.Summary == "" || row.Summary[0] != '#' {
+		return StringRenderer("tags, e.g. `tags` or `tags work`"), nil
+	}
+
+	return HTMLRenderer(fmt.Sprintf(`<div class="tag" style="padding-left: %dem"><a href="/%s/tag/%s">%s</a> <span class="count">%d</span></div>`,
+		strings.Count(row.Summary, "/")*2,
+		url.PathEscape(row.Namespace),
+		html.EscapeString(tagPath(row.Summary)),
+		html.EscapeString(row.Summary),
+		row.Number.Int64,
+	)), nil
+}
+
+type Tags string
+
+func (t Tags) ToRow() *storage.Row {
+	return &storage.Row{
+		Metadata: storage.Metadata{
+			Kind: "tags",
+		},
+	}
+}
+
+// tagPath returns the path of the tag page for tag, without the leading #.
+func tagPath(tag string) string {
+	parts := strings.Split(strings.TrimPrefix(tag, "#"), "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
@@ -1,15 +1,28 @@
 package handler
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"html/template"
+	"maps"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/heyLu/lp/go/things/storage"
 )
 
 var _ Handler = TaskHandler{}
+var _ Grouper = TaskHandler{}
+var _ Loader = TaskHandler{}
+var _ BeforeSaver = TaskHandler{}
+var _ Editor = TaskHandler{}
 
 type TaskHandler struct{}
 
@@ -17,68 +30,475 @@ func (nh TaskHandler) CanHandle(input string) (string, bool) {
 	return "task", strings.HasPrefix(input, "task")
 }
 
-func (nh TaskHandler) Parse(input string) (Thing, error) {
-	idx := strings.Index(input, " ")
-	if idx == -1 {
-		idx = len(input)
-	}
-	content := input[idx:]
-
+// Parse parses tasks like `task !1 due:friday @home +bike fix brakes`, with
+// the priority (1 is the highest) in Number, the due date in Time and the
+// context and project in Fields.  These can be anywhere in the input,
+// after the recurrence rule if the task repeats.
+//
+// Subtasks have the id of their parent task, e.g. `parent:1724567890`.
+func (nh TaskHandler) Parse(ctx context.Context, input string) (Thing, error) {
 	task := Task{
 		Row: &storage.Row{
 			Metadata: storage.Metadata{
 				Kind: "task",
 			},
-			Summary: content,
+			Summary: cutWords(input, 1),
 			Bool: sql.NullBool{
 				Bool:  false,
 				Valid: true,
 			},
-			// TODO: use Num as priority?
 		},
 	}
 
+	words := strings.Fields(input)
+	if len(words) < 2 {
+		return task, nil
+	}
+
+	r, n, err := ParseRecurrence(words[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	if n > 0 {
+		task.Fields = map[string]any{"recur": strings.Join(words[1:1+n], " ")}
+
+		// tasks like `every 2w` are due now, the next one two weeks after
+		// this one is done
+		if r.At != nil || r.Weekday != nil {
+			task.Time.Time = r.First(Now(ctx)).UTC()
+			task.Time.Valid = true
+		}
+	}
+
+	rest := cutWords(input, 1+n)
+	summary := make([]string, 0, 8)
+	fields := wordRe.FindAllStringIndex(rest, -1)
+	for i, loc := range fields {
+		word := rest[loc[0]:loc[1]]
+
+		ok, err := task.parseWord(ctx, word)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			continue
+		}
+
+		// keeping the space before the word, e.g. newlines
+		if len(summary) > 0 {
+			summary = append(summary, rest[fields[i-1][1]:loc[0]])
+		}
+		summary = append(summary, word)
+	}
+	task.Summary = strings.Join(summary, "")
+
 	return task, nil
 }
 
+var (
+	wordRe     = regexp.MustCompile(`\S+`)
+	priorityRe = regexp.MustCompile(`^!([1-9])$`)
+	contextRe  = regexp.MustCompile(`^@(\w[\w/-]*)$`)
+	projectRe  = regexp.MustCompile(`^\+([a-zA-Z][\w/-]*)$`)
+	parentRe   = regexp.MustCompile(`^parent:([0-9]+)$`)
+
+	// checklistRe matches items of markdown task lists, like `- [x] socks`
+	checklistRe = regexp.MustCompile(`(?m)^(\s*[-*+] \[)([ xX])(\] ?)(.*)$`)
+)
+
+// parseWord sets the priority, due date, context or project if word is one.
+func (t Task) parseWord(ctx context.Context, word string) (bool, error) {
+	if m := priorityRe.FindStringSubmatch(word); m != nil {
+		priority, _ := strconv.Atoi(m[1])
+		t.Number = sql.NullInt64{Int64: int64(priority), Valid: true}
+		return true, nil
+	}
+
+	if when, ok := strings.CutPrefix(word, "due:"); ok && when != "" {
+		due, _, err := ParseWhen([]string{when}, Now(ctx))
+		if err != nil {
+			return false, err
+		}
+		t.Time = sql.NullTime{Time: due.UTC(), Valid: true}
+		return true, nil
+	}
+
+	for field, re := range map[string]*regexp.Regexp{"context": contextRe, "project": projectRe, "parent": parentRe} {
+		if m := re.FindStringSubmatch(word); m != nil {
+			if t.Fields == nil {
+				t.Fields = make(map[string]any, 1)
+			}
+			t.Fields[field] = m[1]
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Query lists open tasks by priority and then by due date, or done ones
+// with `task done` and all of them, open ones first, with `task all`.
+//
+// Besides the filters of [parseKindQuery] it supports `due:<when>` for tasks
+// due until the end of that day, `!1` for the priority, `@home` for the
+// context and `+bike` for the project.
 func (nh TaskHandler) Query(ctx context.Context, db storage.Storage, namespace string, input string) (storage.Rows, error) {
-	parts := strings.SplitN(input, " ", 2)
-	if len(parts) == 1 {
-		return db.Query(ctx, namespace, storage.Kind("task"))
+	_, query, _ := strings.Cut(input, " ")
+	query, conditions := doneConditions(query, "done")
+	conditions = append(conditions, storage.Kind("task"))
+
+	other := make([]string, 0, 2)
+	for _, word := range strings.Fields(query) {
+		var filter Task
+		filter.Row = &storage.Row{}
+
+		ok, err := filter.parseWord(ctx, word)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			other = append(other, word)
+			continue
+		}
+
+		switch {
+		case filter.Number.Valid:
+			conditions = append(conditions, storage.Eq("number", filter.Number.Int64))
+		case filter.Time.Valid:
+			endOfDay := atTimeOfDay(filter.Time.Time.In(Location(ctx)), 0).AddDate(0, 0, 1)
+			conditions = append(conditions, storage.Lt("time", endOfDay.Unix()))
+		default:
+			// parent:<id> lists the subtasks of a task
+			for field, val := range filter.Fields {
+				conditions = append(conditions, storage.Field(field, val))
+			}
+		}
+	}
+
+	terms, queryConditions := parseKindQuery(ctx, strings.Join(other, " "))
+
+	rows, err := db.Search(ctx, namespace, terms, append(conditions, queryConditions...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks, err := collectRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// subtasks are shown with their parent, if it is listed
+	listed := make(map[string]bool, len(tasks))
+	for _, task := range tasks {
+		listed[strconv.FormatInt(task.ID, 10)] = true
+	}
+	tasks = slices.DeleteFunc(tasks, func(task *storage.Row) bool {
+		return listed[Task{Row: task}.Parent()]
+	})
+
+	slices.SortStableFunc(tasks, func(a, b *storage.Row) int {
+		if a.Bool.Bool != b.Bool.Bool {
+			if a.Bool.Bool {
+				return 1
+			}
+			return -1
+		}
+
+		if c := compareMissingLast(a.Number.Valid, b.Number.Valid, a.Number.Int64, b.Number.Int64); c != 0 {
+			return c
+		}
+		return compareMissingLast(a.Time.Valid, b.Time.Valid, a.Time.Time.Unix(), b.Time.Time.Unix())
+	})
+
+	return &sliceRows{rows: tasks}, nil
+}
+
+// compareMissingLast compares a and b, with missing values after all others.
+func compareMissingLast(validA, validB bool, a, b int64) int {
+	switch {
+	case validA && validB:
+		return cmp.Compare(a, b)
+	case validA:
+		return -1
+	case validB:
+		return 1
+	}
+	return 0
+}
+
+func (nh TaskHandler) Group(ctx context.Context, row *storage.Row) string {
+	if row.Bool.Bool {
+		return "done"
+	}
+	return "open"
+}
+
+// Load loads the subtasks of rows, in one query for all of them.
+func (nh TaskHandler) Load(ctx context.Context, db storage.Storage, rows []*storage.Row) ([]*storage.Row, error) {
+	parents := make([]storage.Condition, 0, len(rows))
+	for _, row := range rows {
+		if row.ID != 0 {
+			parents = append(parents, storage.Field("parent", strconv.FormatInt(row.ID, 10)))
+		}
+	}
+	if len(parents) == 0 {
+		return rows, nil
+	}
+
+	children, err := db.Query(ctx, rows[0].Namespace, storage.Kind("task"), storage.Or(parents...))
+	if err != nil {
+		return nil, err
+	}
+
+	subtasks, err := collectRows(children)
+	if err != nil {
+		return nil, err
+	}
+	if len(subtasks) == 0 {
+		return rows, nil
+	}
+	slices.Reverse(subtasks) // oldest first, like items of a checklist
+
+	byParent := make(map[string][]*storage.Row, len(rows))
+	for _, subtask := range subtasks {
+		parent := Task{Row: subtask}.Parent()
+		byParent[parent] = append(byParent[parent], subtask)
+	}
+
+	loaded := make([]*storage.Row, len(rows))
+	for i, row := range rows {
+		loaded[i] = row
+
+		subtasks := byParent[strconv.FormatInt(row.ID, 10)]
+		if row.ID == 0 || len(subtasks) == 0 {
+			continue
+		}
+
+		withSubtasks := *row
+		withSubtasks.Fields = maps.Clone(row.Fields)
+		if withSubtasks.Fields == nil {
+			withSubtasks.Fields = make(map[string]any, 1)
+		}
+		withSubtasks.Fields["subtasks"] = subtasks
+		loaded[i] = &withSubtasks
+	}
+	return loaded, nil
+}
+
+// BeforeSave checks that the parent of subtasks is a task.
+func (nh TaskHandler) BeforeSave(ctx context.Context, db storage.Storage, row *storage.Row) error {
+	parent := Task{Row: row}.Parent()
+	if parent == "" {
+		return nil
+	}
+
+	found, err := db.Find(ctx, row.Namespace, parent)
+	if err == nil && found.Kind != "task" {
+		err = storage.ErrNotFound
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("there is no task %s to be the parent", parent)
 	}
-	return db.Query(ctx, namespace, storage.Kind("task"), storage.Match("summary", parts[1]))
+	return err
+}
+
+// Edit checks or unchecks items of the checklist in the content of a task,
+// with `check=<index>`.
+func (nh TaskHandler) Edit(ctx context.Context, row *storage.Row, form url.Values) error {
+	if !form.Has("check") {
+		return nil
+	}
+
+	index, err := strconv.Atoi(form.Get("check"))
+	if err != nil {
+		return fmt.Errorf("invalid checklist item %q", form.Get("check"))
+	}
+
+	i := 0
+	found := false
+	row.Content.String = checklistRe.ReplaceAllStringFunc(row.Content.String, func(line string) string {
+		defer func() { i++ }()
+		if i != index {
+			return line
+		}
+
+		found = true
+		m := checklistRe.FindStringSubmatch(line)
+		mark := "x"
+		if m[2] != " " {
+			mark = " "
+		}
+		return m[1] + mark + m[3] + m[4]
+	})
+	if !found {
+		return fmt.Errorf("no checklist item %d", index)
+	}
+
+	return nil
 }
 
 func (nh TaskHandler) Render(ctx context.Context, row *storage.Row) (Renderer, error) {
 	return TemplateRenderer{
 		Template: taskTemplate,
-		Data:     Task{Row: row},
+		Data:     Task{Row: row, now: Now(ctx)},
 	}, nil
 }
 
 type Task struct {
 	*storage.Row
+
+	// now is when the task is rendered, see [Task.Overdue]
+	now time.Time
 }
 
 func (n Task) ToRow() *storage.Row { return n.Row }
 
+// Recur is the recurrence rule of the task, if it repeats.
+func (n Task) Recur() string {
+	rule, _ := n.Fields["recur"].(string)
+	return rule
+}
+
+func (n Task) Context() string {
+	c, _ := n.Fields["context"].(string)
+	return c
+}
+
+func (n Task) Project() string {
+	project, _ := n.Fields["project"].(string)
+	return project
+}
+
+// Parent is the id of the parent task of subtasks.
+func (n Task) Parent() string {
+	parent, _ := n.Fields["parent"].(string)
+	return parent
+}
+
+// Subtasks are the subtasks of the task, see [TaskHandler.Load].
+func (n Task) Subtasks() []Task {
+	rows, _ := n.Fields["subtasks"].([]*storage.Row)
+	subtasks := make([]Task, len(rows))
+	for i, row := range rows {
+		subtasks[i] = Task{Row: row, now: n.now}
+	}
+	return subtasks
+}
+
+type ChecklistItem struct {
+	Index int
+	Done  bool
+	Text  string
+}
+
+// Checklist are the items of markdown task lists in the content.
+func (n Task) Checklist() []ChecklistItem {
+	matches := checklistRe.FindAllStringSubmatch(n.Content.String, -1)
+	items := make([]ChecklistItem, len(matches))
+	for i, m := range matches {
+		items[i] = ChecklistItem{Index: i, Done: m[2] != " ", Text: m[4]}
+	}
+	return items
+}
+
+// Notes is the content without the checklist.
+func (n Task) Notes() string {
+	return strings.TrimSpace(checklistRe.ReplaceAllString(n.Content.String, ""))
+}
+
+// progress returns the number of done and all subtasks and checklist items.
+func (n Task) progress() (done int, total int) {
+	for _, subtask := range n.Subtasks() {
+		if subtask.Bool.Bool {
+			done++
+		}
+		total++
+	}
+	for _, item := range n.Checklist() {
+		if item.Done {
+			done++
+		}
+		total++
+	}
+	return done, total
+}
+
+// Progress is like `3/5`, if the task has subtasks or a checklist.
+func (n Task) Progress() string {
+	done, total := n.progress()
+	if total == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", done, total)
+}
+
+// Open is the number of subtasks and checklist items that are not done yet.
+func (n Task) Open() int {
+	done, total := n.progress()
+	return total - done
+}
+
+// Overdue is true for open tasks that were due already.
+func (n Task) Overdue() bool {
+	return !n.Bool.Bool && n.Time.Valid && n.Time.Time.Before(n.now)
+}
+
 var taskTemplate = template.Must(template.Must(commonTemplates.Clone()).Parse(`
 {{ define "content" }}
 <div{{ if .Bool.Bool }} class="done"{{ end }}>
 	<header>
 		{{ if .Bool.Bool }}<s>{{ end }}
-		<input type="checkbox"
+		<input type="checkbox" name="bool"
 			{{ if .Bool.Bool }} checked{{ end }}
-			{{ if (gt .ID 0) }} hx-post="/{{ .Namespace }}/{{ .Kind }}/{{ .ID }}" hx-include="next [name='bool']"{{ end }}
+			{{ if (gt .ID 0) }} hx-post="/{{ .Namespace }}/{{ .Kind }}/{{ .ID }}" hx-vals='{"bool-valid": "true"}' hx-swap="none"{{ end }}
+			{{ if and (not .Bool.Bool) (gt .Open 0) }} hx-confirm="{{ .Open }} subtasks or items are still open, done anyway?"{{ end }}
 			/>
 
 		<h1>{{ markdown .Summary }}</h1>
 		{{ if .Bool.Bool }}</s>{{ end }}
+		{{ with .Progress }}<span class="progress">{{ . }}</span>{{ end }}
 	</header>
 
-	{{ markdown .Content.String }}
+	{{ if or .Number.Valid .Time.Valid .Context .Project .Recur .Parent }}
+	<p class="task-meta">
+		{{ if .Number.Valid }}<span class="priority priority-{{ .Number.Int64 }}">!{{ .Number.Int64 }}</span>{{ end }}
+		{{ if .Time.Valid }}<span class="due{{ if .Overdue }} overdue{{ end }}">due <time datetime="{{ .Time.Time.Format "2006-01-02T15:04:05Z07:00" }}">{{ (local .Time.Time).Format "Mon, 02 Jan 15:04" }}</time></span>{{ end }}
+		{{ with .Context }}<span class="context">@{{ . }}</span>{{ end }}
+		{{ with .Project }}<span class="project">+{{ . }}</span>{{ end }}
+		{{ with .Recur }}<span class="recur">↻ {{ . }}</span>{{ end }}
+		{{ with .Parent }}<a class="parent" href="/{{ $.Namespace }}/task/{{ . }}">↑ parent</a>{{ end }}
+	</p>
+	{{ end }}
+
+	{{ with .Checklist }}
+	<ul class="checklist">
+		{{ range . }}
+		<li><label>
+			<input type="checkbox"{{ if .Done }} checked{{ end }}
+				{{ if (gt $.ID 0) }} hx-post="/{{ $.Namespace }}/{{ $.Kind }}/{{ $.ID }}" hx-vals='{"check": "{{ .Index }}"}' hx-target="closest section.thing" hx-swap="outerHTML"{{ else }} disabled{{ end }}
+				/>
+			{{ .Text }}
+		</label></li>
+		{{ end }}
+	</ul>
+	{{ end }}
+
+	{{ with .Subtasks }}
+	<ul class="subtasks">
+		{{ range . }}
+		<li{{ if .Bool.Bool }} class="done"{{ end }}>
+			<input type="checkbox" name="bool"{{ if .Bool.Bool }} checked{{ end }}
+				hx-post="/{{ .Namespace }}/{{ .Kind }}/{{ .ID }}" hx-vals='{"bool-valid": "true"}' hx-target="closest section.thing" hx-swap="none"
+				/>
+			<a href="/{{ .Namespace }}/{{ .Kind }}/{{ .ID }}">{{ .Summary }}</a>
+		</li>
+		{{ end }}
+	</ul>
+	{{ end }}
+
+	{{ markdown .Notes }}
 
 </div>
-<input type="hidden" name="bool" value="{{ .Bool.Bool }}" />
-{{ end }} 
+{{ end }}
 `))
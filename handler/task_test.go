@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/heyLu/lp/go/things/storage"
+)
+
+func TestParseTask(t *testing.T) {
+	ctx := WithLocation(context.Background(), time.UTC)
+
+	thing, err := TaskHandler{}.Parse(ctx, "task !2 due:2024-09-06 @home fix bike +bike #errands")
+	require.NoError(t, err)
+	row := thing.ToRow()
+	require.Equal(t, "fix bike #errands", row.Summary)
+	require.Equal(t, sql.NullInt64{Int64: 2, Valid: true}, row.Number)
+	require.True(t, row.Time.Valid)
+	require.Equal(t, time.Date(2024, 9, 6, 9, 0, 0, 0, time.UTC), row.Time.Time)
+	require.Equal(t, map[string]any{"context": "home", "project": "bike"}, row.Fields)
+
+	thing, err = TaskHandler{}.Parse(ctx, "task every 2w !1 water plants\nthe big ones")
+	require.NoError(t, err)
+	row = thing.ToRow()
+	require.Equal(t, "water plants\nthe big ones", row.Summary)
+	require.Equal(t, int64(1), row.Number.Int64)
+	require.Equal(t, "every 2w", row.Fields["recur"])
+
+	thing, err = TaskHandler{}.Parse(ctx, "task buy 2 apples! email me@example.com")
+	require.NoError(t, err)
+	row = thing.ToRow()
+	require.Equal(t, "buy 2 apples! email me@example.com", row.Summary)
+	require.False(t, row.Number.Valid)
+	require.False(t, row.Time.Valid)
+	require.Nil(t, row.Fields)
+
+	_, err = TaskHandler{}.Parse(ctx, "task due:someday fix bike")
+	require.Error(t, err)
+}
+
+func TestTaskQuery(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.NewDBStorage(ctx, ":memory:")
+	require.NoError(t, err)
+
+	for _, input := range []string{
+		"task someday",
+		"task due:2024-09-06 later",
+		"task !2 @home soon",
+		"task !1 due:2024-09-01 @work first",
+		"task !1 due:2024-09-02 @home second",
+		"task !1 done already",
+	} {
+		thing, err := TaskHandler{}.Parse(ctx, input)
+		require.NoError(t, err)
+		row := thing.ToRow()
+		row.Namespace = "test"
+		if row.Summary == "done already" {
+			row.Bool.Bool = true
+		}
+		require.NoError(t, db.Insert(ctx, row))
+	}
+
+	summaries := func(input string) []string {
+		rows, err := TaskHandler{}.Query(ctx, db, "test", input)
+		require.NoError(t, err)
+		summaries := []string{}
+		for rows.Next() {
+			var row storage.Row
+			require.NoError(t, rows.Scan(&row))
+			summaries = append(summaries, row.Summary)
+		}
+		return summaries
+	}
+
+	require.Equal(t, []string{"first", "second", "soon", "later", "someday"}, summaries("task"))
+	require.Equal(t, []string{"second", "soon"}, summaries("task @home"))
+	require.Equal(t, []string{"first", "second"}, summaries("task !1"))
+	require.Equal(t, []string{"first", "second"}, summaries("task due:2024-09-02"))
+	require.Equal(t, []string{"done already"}, summaries("task done"))
+	require.Equal(t, []string{"first", "second", "done already"}, summaries("task all !1"))
+	require.Equal(t, []string{"first", "second", "soon", "later", "someday", "done already"}, summaries("task all"))
+}
+
+func TestTaskChecklist(t *testing.T) {
+	ctx := context.Background()
+
+	row := &storage.Row{
+		Metadata: storage.Metadata{Kind: "task", ID: 1},
+		Summary:  "pack",
+		Content:  sql.NullString{String: "for the trip\n\n- [ ] socks\n- [x] passport\n* [ ] charger", Valid: true},
+	}
+	task := Task{Row: row}
+	require.Equal(t, []ChecklistItem{{0, false, "socks"}, {1, true, "passport"}, {2, false, "charger"}}, task.Checklist())
+	require.Equal(t, "for the trip", task.Notes())
+	require.Equal(t, "1/3", task.Progress())
+
+	require.NoError(t, TaskHandler{}.Edit(ctx, row, url.Values{"check": {"0"}}))
+	require.NoError(t, TaskHandler{}.Edit(ctx, row, url.Values{"check": {"1"}}))
+	require.Equal(t, "for the trip\n\n- [x] socks\n- [ ] passport\n* [ ] charger", row.Content.String)
+
+	require.Error(t, TaskHandler{}.Edit(ctx, row, url.Values{"check": {"3"}}))
+	require.NoError(t, TaskHandler{}.Edit(ctx, row, url.Values{"bool": {"on"}}))
+}
+
+func TestSubtasks(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.NewDBStorage(ctx, ":memory:")
+	require.NoError(t, err)
+
+	insert := func(input string) *storage.Row {
+		thing, err := TaskHandler{}.Parse(ctx, input)
+		require.NoError(t, err)
+		row := thing.ToRow()
+		row.Namespace = "test"
+		require.NoError(t, TaskHandler{}.BeforeSave(ctx, db, row))
+		require.NoError(t, db.Insert(ctx, row))
+		return row
+	}
+
+	parent := insert("task fix bike")
+	parent.Content = sql.NullString{String: "- [x] find tools", Valid: true}
+	require.NoError(t, db.Update(ctx, parent))
+	id := strconv.FormatInt(parent.ID, 10)
+	first := insert("task parent:" + id + " buy brake pads")
+	require.Equal(t, "buy brake pads", first.Summary)
+	require.Equal(t, id, first.Fields["parent"])
+	first.Bool.Bool = true
+	require.NoError(t, db.Update(ctx, first))
+	insert("task parent:" + id + " adjust brakes")
+	insert("task other")
+
+	loaded, err := TaskHandler{}.Load(ctx, db, []*storage.Row{parent, first})
+	require.NoError(t, err)
+	require.Nil(t, parent.Fields["subtasks"])
+	require.Same(t, first, loaded[1])
+	task := Task{Row: loaded[0]}
+	require.Equal(t, []string{"buy brake pads", "adjust brakes"}, []string{task.Subtasks()[0].Summary, task.Subtasks()[1].Summary})
+	require.Equal(t, "2/3", task.Progress())
+	require.Equal(t, 1, task.Open())
+
+	rows, err := TaskHandler{}.Query(ctx, db, "test", "task")
+	require.NoError(t, err)
+	listed, err := collectRows(rows)
+	require.NoError(t, err)
+	require.Len(t, listed, 2)
+
+	rows, err = TaskHandler{}.Query(ctx, db, "test", "task all parent:"+id)
+	require.NoError(t, err)
+	listed, err = collectRows(rows)
+	require.NoError(t, err)
+	require.Len(t, listed, 2)
+
+	// parents must be tasks in the same namespace
+	note := &storage.Row{Metadata: storage.Metadata{Namespace: "test", Kind: "note"}, Summary: "not a task"}
+	require.NoError(t, db.Insert(ctx, note))
+	for _, input := range []string{"task parent:1 orphan", "task parent:" + strconv.FormatInt(note.ID, 10) + " orphan"} {
+		thing, err := TaskHandler{}.Parse(ctx, input)
+		require.NoError(t, err)
+		row := thing.ToRow()
+		row.Namespace = "test"
+		require.Error(t, TaskHandler{}.BeforeSave(ctx, db, row), input)
+	}
+
+	thing, err := TaskHandler{}.Parse(ctx, "task parent:"+id+" elsewhere")
+	require.NoError(t, err)
+	row := thing.ToRow()
+	row.Namespace = "other"
+	require.Error(t, TaskHandler{}.BeforeSave(ctx, db, row))
+}
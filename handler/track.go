@@ -2,9 +2,7 @@ package handler
 
 import (
 	"context"
-	"fmt"
 	"html/template"
-	"math"
 	"strconv"
 	"strings"
 
@@ -12,6 +10,7 @@ import (
 )
 
 var _ Handler = TrackHandler{}
+var _ Summarizer = TrackHandler{}
 
 type TrackHandler struct{}
 
@@ -19,7 +18,7 @@ func (th TrackHandler) CanHandle(input string) (string, bool) {
 	return "track", strings.HasPrefix(input, "track")
 }
 
-func (th TrackHandler) Parse(input string) (Thing, error) {
+func (th TrackHandler) Parse(ctx context.Context, input string) (Thing, error) {
 	var t Track
 	t.Row = &storage.Row{Metadata: storage.Metadata{Kind: "track"}}
 
@@ -33,9 +32,13 @@ func (th TrackHandler) Parse(input string) (Thing, error) {
 		if err != nil {
 			return nil, err
 		}
+		err = trackCategory(ctx, t.Summary).Check(t.Summary, num)
+		if err != nil {
+			return nil, err
+		}
+
 		t.Float.Float64 = num
 		t.Float.Valid = true
-
 	}
 
 	if len(parts) > 3 {
@@ -47,7 +50,7 @@ func (th TrackHandler) Parse(input string) (Thing, error) {
 }
 
 func (th TrackHandler) Query(ctx context.Context, db storage.Storage, namespace string, input string) (storage.Rows, error) {
-	thing, err := th.Parse(input)
+	thing, err := th.Parse(ctx, input)
 	if err != nil {
 		return nil, err
 	}
@@ -61,13 +64,43 @@ func (th TrackHandler) Query(ctx context.Context, db storage.Storage, namespace
 	return db.Query(ctx, namespace, storage.Kind(track.Kind), storage.Summary(track.Summary))
 }
 
+// Summarize shows the stats of the category in input, if there is one.
+func (th TrackHandler) Summarize(ctx context.Context, db storage.Storage, namespace string, input string) (Renderer, error) {
+	thing, err := th.Parse(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	track := thing.(*Track)
+	if track.Summary == "" {
+		return nil, nil
+	}
+
+	rows, err := db.Query(ctx, namespace, storage.Kind(track.Kind), storage.Summary(track.Summary))
+	if err != nil {
+		return nil, err
+	}
+
+	tracked, err := collectRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := computeTrackStats(track.Summary, trackCategory(ctx, track.Summary), tracked, Now(ctx), Location(ctx))
+	return TemplateRenderer{Template: trackStatsTemplate, Data: stats}, nil
+}
+
 func (th TrackHandler) Render(ctx context.Context, row *storage.Row) (Renderer, error) {
-	return TemplateRenderer{Template: trackTemplate, Data: &Track{Row: row}}, nil
+	return TemplateRenderer{Template: trackTemplate, Data: &Track{Row: row, category: trackCategory(ctx, row.Summary)}}, nil
 }
 
 var _ Thing = &Track{}
 
-type Track struct{ *storage.Row }
+type Track struct {
+	*storage.Row
+
+	category TrackCategory
+}
 
 func (t *Track) Category() string { return t.Summary }
 func (t *Track) Num() *float64 {
@@ -80,27 +113,11 @@ func (t *Track) Num() *float64 {
 func (t *Track) Notes() string { return t.Content.String }
 
 func (t *Track) FormatValue() string {
-	i, f := math.Modf(t.Float.Float64)
-	switch t.Summary {
-	case "sport":
-		if f < 0.01 {
-			return fmt.Sprintf("%dmin", int(i))
-		}
-		return fmt.Sprintf("%d:%02dmin", int(i), int(f*100))
-	case "sleep":
-		return fmt.Sprintf("%.2fhrs", t.Float.Float64)
-	case "ready", "up", "bed":
-		return fmt.Sprintf("%d:%02dhrs", int(i), int(f*100))
-	case "groceries":
-		return fmt.Sprintf("%.2feur", t.Float.Float64)
-	case "weight":
-		return fmt.Sprintf("%.2fkg", t.Float.Float64)
-	default:
-		if f < 0.001 {
-			return fmt.Sprintf("%d", int(i))
-		}
-		return fmt.Sprintf("%f", t.Float.Float64)
-	}
+	return t.category.FormatValue(t.Float.Float64)
+}
+
+func (t *Track) Style() template.CSS {
+	return t.category.Style(t.Float.Float64)
 }
 
 func (t *Track) ToRow() *storage.Row { return t.Row }
@@ -109,7 +126,7 @@ var trackTemplate = template.Must(template.Must(commonTemplates.Clone()).Parse(`
 {{ define "content" }}
 {{ .Category }}
 {{ if .Num }}
-<span{{ if (eq .Category "mood") }} style="opacity: calc({{ .Num }}/100)"{{ end }}>
+<span{{ with .Style }} style="{{ . }}"{{ end }}>
 	{{ .FormatValue }}
 </span>
 {{ end }}
@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// TrackCategory defines how values of a track category are shown, set with
+// e.g. `setting track.run format=decimal unit=km decimals=1`.
+//
+// Formats are
+//
+//   - decimal: 7.5 (the default)
+//   - duration: minutes and seconds, 30.15 is 30:15
+//   - clock: hours and minutes, 7.30 is 7:30
+//   - currency: 12.50
+//
+// Min and max limit the values that can be tracked, and together with scale
+// (opacity or color) make values stand out visually.
+type TrackCategory struct {
+	Format   string
+	Unit     string
+	Decimals int
+
+	Min, Max *float64
+	Scale    string
+}
+
+var trackFormats = []string{"decimal", "duration", "clock", "currency"}
+var trackScales = []string{"opacity", "color"}
+
+// defaultTrackCategories are used unless there is a setting for the category.
+var defaultTrackCategories = map[string]TrackCategory{
+	"sport":     {Format: "duration", Unit: "min"},
+	"sleep":     {Format: "decimal", Unit: "hrs", Decimals: 2},
+	"ready":     {Format: "clock", Unit: "hrs"},
+	"up":        {Format: "clock", Unit: "hrs"},
+	"bed":       {Format: "clock", Unit: "hrs"},
+	"groceries": {Format: "currency", Unit: "eur"},
+	"weight":    {Format: "decimal", Unit: "kg", Decimals: 2},
+	// not limited by default, `setting track.mood min=0 max=100 scale=opacity`
+	// makes it stand out
+	"mood": {Format: "decimal", Decimals: -1},
+}
+
+// ParseTrackCategory parses the value of a `track.<category>` setting, like
+// `format=currency unit=usd`.
+func ParseTrackCategory(definition string) (TrackCategory, error) {
+	category := TrackCategory{Format: "decimal", Decimals: -1}
+	for _, field := range strings.Fields(definition) {
+		key, val, ok := strings.Cut(field, "=")
+		if !ok || val == "" {
+			return category, fmt.Errorf("invalid %q, use key=value", field)
+		}
+
+		switch key {
+		case "format":
+			if !slices.Contains(trackFormats, val) {
+				return category, fmt.Errorf("unknown format %q, use one of %s", val, strings.Join(trackFormats, ", "))
+			}
+			category.Format = val
+		case "unit":
+			category.Unit = val
+		case "decimals":
+			decimals, err := strconv.Atoi(val)
+			if err != nil || decimals < 0 {
+				return category, fmt.Errorf("invalid decimals %q", val)
+			}
+			category.Decimals = decimals
+		case "min", "max":
+			num, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				return category, fmt.Errorf("invalid %s %q", key, val)
+			}
+			if key == "min" {
+				category.Min = &num
+			} else {
+				category.Max = &num
+			}
+		case "scale":
+			if !slices.Contains(trackScales, val) {
+				return category, fmt.Errorf("unknown scale %q, use one of %s", val, strings.Join(trackScales, ", "))
+			}
+			category.Scale = val
+		default:
+			return category, fmt.Errorf("unknown key %q, use format, unit, decimals, min, max or scale", key)
+		}
+	}
+
+	if category.Scale != "" && (category.Min == nil || category.Max == nil) {
+		return category, fmt.Errorf("scale needs min and max")
+	}
+	if category.Min != nil && category.Max != nil && *category.Min >= *category.Max {
+		return category, fmt.Errorf("min must be less than max")
+	}
+
+	return category, nil
+}
+
+// trackCategory returns the definition of the category name, from the
+// settings in ctx or the defaults.
+func trackCategory(ctx context.Context, name string) TrackCategory {
+	if definition, ok := SettingsFrom(ctx)["track."+name]; ok {
+		category, err := ParseTrackCategory(definition)
+		if err == nil {
+			return category
+		}
+	}
+
+	if category, ok := defaultTrackCategories[name]; ok {
+		return category
+	}
+
+	return TrackCategory{Format: "decimal", Decimals: -1}
+}
+
+// Check returns an error if value is out of the range of the category.
+func (tc TrackCategory) Check(name string, value float64) error {
+	if tc.Min != nil && value < *tc.Min {
+		return fmt.Errorf("%s must be at least %g", name, *tc.Min)
+	}
+	if tc.Max != nil && value > *tc.Max {
+		return fmt.Errorf("%s must be at most %g", name, *tc.Max)
+	}
+	if _, f := math.Modf(value); tc.sexagesimal() && math.Round(math.Abs(f)*100) >= 60 {
+		return fmt.Errorf("%s must have less than 60 after the point, e.g. %d.45 for %d:45", name, int(value), int(value))
+	}
+	return nil
+}
+
+// sexagesimal is true for formats that count to 60 after the point.
+func (tc TrackCategory) sexagesimal() bool {
+	return tc.Format == "duration" || tc.Format == "clock"
+}
+
+// sixtieths converts durations to seconds and clock values to minutes, e.g.
+// 7.45 (7:45) to 465, so that they can be added up.  Other values stay as
+// they are.
+func (tc TrackCategory) sixtieths(value float64) float64 {
+	if !tc.sexagesimal() {
+		return value
+	}
+	i, f := math.Modf(value)
+	return i*60 + math.Round(f*100)
+}
+
+// fromSixtieths is the inverse of [TrackCategory.sixtieths], rounding to
+// whole seconds or minutes.
+func (tc TrackCategory) fromSixtieths(value float64) float64 {
+	if !tc.sexagesimal() {
+		return value
+	}
+	value = math.Round(value)
+	i := math.Trunc(value / 60)
+	return i + (value-i*60)/100
+}
+
+// FormatValue formats value with the format and unit of the category.
+func (tc TrackCategory) FormatValue(value float64) string {
+	// carried over, in case 60 or more after the point were saved
+	sixtieths := int(math.Round(tc.sixtieths(math.Abs(value))))
+	sign := ""
+	if value < 0 && sixtieths > 0 {
+		sign = "-"
+	}
+
+	var formatted string
+	switch tc.Format {
+	case "duration":
+		if sixtieths%60 == 0 {
+			formatted = fmt.Sprintf("%s%d", sign, sixtieths/60)
+		} else {
+			formatted = fmt.Sprintf("%s%d:%02d", sign, sixtieths/60, sixtieths%60)
+		}
+	case "clock":
+		formatted = fmt.Sprintf("%s%d:%02d", sign, sixtieths/60, sixtieths%60)
+	case "currency":
+		formatted = fmt.Sprintf("%.2f", value)
+	default:
+		if tc.Decimals >= 0 {
+			formatted = strconv.FormatFloat(value, 'f', tc.Decimals, 64)
+		} else {
+			// as many as needed, but not too many
+			formatted = strconv.FormatFloat(math.Round(value*1000)/1000, 'f', -1, 64)
+		}
+	}
+
+	return formatted + tc.Unit
+}
+
+// Style returns css to show value on the scale of the category.
+func (tc TrackCategory) Style(value float64) template.CSS {
+	if tc.Scale == "" || tc.Min == nil || tc.Max == nil {
+		return ""
+	}
+
+	pos := (value - *tc.Min) / (*tc.Max - *tc.Min)
+	pos = max(0, min(1, pos))
+
+	switch tc.Scale {
+	case "opacity":
+		return template.CSS(fmt.Sprintf("opacity: %.2f", max(0.1, pos)))
+	case "color":
+		// from red to green
+		return template.CSS(fmt.Sprintf("color: hsl(%.0f, 70%%, 40%%)", pos*120))
+	}
+	return ""
+}
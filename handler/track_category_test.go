@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrackCategoryDefaults(t *testing.T) {
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		category string
+		value    float64
+		want     string
+	}{
+		{"sport", 30, "30min"},
+		{"sport", 30.15, "30:15min"},
+		{"sleep", 7.5, "7.50hrs"},
+		{"up", 7.3, "7:30hrs"},
+		{"groceries", 12.5, "12.50eur"},
+		{"weight", 70.25, "70.25kg"},
+		{"mood", 75, "75"},
+		{"coffee", 2, "2"},
+		{"coffee", 1.5, "1.5"},
+	} {
+		require.Equal(t, tc.want, trackCategory(ctx, tc.category).FormatValue(tc.value), "%s %v", tc.category, tc.value)
+	}
+
+	require.NoError(t, trackCategory(ctx, "mood").Check("mood", 101))
+	require.NoError(t, trackCategory(ctx, "mood").Check("mood", -5))
+	require.Error(t, trackCategory(ctx, "sport").Check("sport", 30.75))
+	require.Error(t, trackCategory(ctx, "up").Check("up", 7.6))
+	require.NoError(t, trackCategory(ctx, "up").Check("up", 7.59))
+	require.NoError(t, trackCategory(ctx, "sleep").Check("sleep", 7.75))
+
+	// saved before they were checked
+	require.Equal(t, "31:15min", trackCategory(ctx, "sport").FormatValue(30.75))
+	require.Equal(t, "7:45hrs", trackCategory(ctx, "up").FormatValue(trackCategory(ctx, "up").fromSixtieths(465)))
+	require.Empty(t, trackCategory(ctx, "mood").Style(75))
+}
+
+func TestTrackCategorySettings(t *testing.T) {
+	ctx := WithSettings(context.Background(), Settings{
+		"track.coffee":    "unit=cups max=10",
+		"track.groceries": "format=currency unit=usd",
+		"track.run":       "unit=km decimals=1 min=0 max=50 scale=color",
+		"track.mood":      "min=0 max=100 scale=opacity",
+	})
+
+	require.Equal(t, "2cups", trackCategory(ctx, "coffee").FormatValue(2))
+	require.Error(t, trackCategory(ctx, "coffee").Check("coffee", 11))
+	require.Equal(t, "12.50usd", trackCategory(ctx, "groceries").FormatValue(12.5))
+	require.Equal(t, "5.0km", trackCategory(ctx, "run").FormatValue(5))
+	require.Equal(t, "color: hsl(120, 70%, 40%)", string(trackCategory(ctx, "run").Style(50)))
+	require.Equal(t, "opacity: 0.75", string(trackCategory(ctx, "mood").Style(75)))
+	require.Error(t, trackCategory(ctx, "mood").Check("mood", 101))
+
+	_, err := TrackHandler{}.Parse(ctx, "track coffee 12")
+	require.Error(t, err)
+
+	for _, invalid := range []string{"format=fancy", "unit", "decimals=-1", "min=ten", "scale=opacity", "min=5 max=1", "color=red"} {
+		_, err := ParseTrackCategory(invalid)
+		require.Error(t, err, invalid)
+
+		_, err = SettingHandler{}.Parse(ctx, "setting track.coffee "+invalid)
+		require.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/heyLu/lp/go/things/storage"
+)
+
+// TrackStats summarizes the values tracked for a category.
+type TrackStats struct {
+	Category string
+
+	Count          int
+	Min, Max, Mean float64
+
+	Weekly  []TrackAverage
+	Monthly []TrackAverage
+
+	// CurrentStreak is the number of days in a row with values up to today,
+	// or up to yesterday if nothing was tracked today yet.
+	CurrentStreak int
+	LongestStreak int
+
+	category TrackCategory
+	points   []trackPoint
+}
+
+type TrackAverage struct {
+	Label string
+	Mean  float64
+	Count int
+}
+
+type trackPoint struct {
+	date  time.Time
+	value float64
+}
+
+const (
+	statsWeeks  = 8
+	statsMonths = 6
+)
+
+// computeTrackStats computes the stats of rows, with days, weeks and months
+// in loc.
+func computeTrackStats(name string, category TrackCategory, rows []*storage.Row, now time.Time, loc *time.Location) *TrackStats {
+	stats := &TrackStats{Category: name, category: category}
+
+	for _, row := range rows {
+		if !row.Float.Valid {
+			continue
+		}
+		// clock and duration values are added up in minutes or seconds
+		stats.points = append(stats.points, trackPoint{date: row.DateCreated.In(loc), value: category.sixtieths(row.Float.Float64)})
+	}
+	slices.SortFunc(stats.points, func(a, b trackPoint) int { return a.date.Compare(b.date) })
+
+	if len(stats.points) == 0 {
+		return stats
+	}
+
+	stats.Count = len(stats.points)
+	stats.Min, stats.Max = math.Inf(1), math.Inf(-1)
+	sum := 0.0
+	for _, p := range stats.points {
+		stats.Min = min(stats.Min, p.value)
+		stats.Max = max(stats.Max, p.value)
+		sum += p.value
+	}
+	stats.Mean = sum / float64(stats.Count)
+
+	stats.Weekly = averages(stats.points, statsWeeks, func(t time.Time) string {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	})
+	stats.Monthly = averages(stats.points, statsMonths, func(t time.Time) string {
+		return t.Format("2006-01")
+	})
+
+	stats.CurrentStreak, stats.LongestStreak = streaks(stats.points, now.In(loc))
+
+	return stats
+}
+
+// averages groups points by label, returning the last n groups.
+func averages(points []trackPoint, n int, label func(t time.Time) string) []TrackAverage {
+	avgs := make([]TrackAverage, 0, n)
+	sum := 0.0
+	for _, p := range points {
+		l := label(p.date)
+		if len(avgs) == 0 || avgs[len(avgs)-1].Label != l {
+			if len(avgs) > 0 {
+				avgs[len(avgs)-1].Mean = sum / float64(avgs[len(avgs)-1].Count)
+			}
+			avgs = append(avgs, TrackAverage{Label: l})
+			sum = 0
+		}
+		avgs[len(avgs)-1].Count++
+		sum += p.value
+	}
+	avgs[len(avgs)-1].Mean = sum / float64(avgs[len(avgs)-1].Count)
+
+	if len(avgs) > n {
+		avgs = avgs[len(avgs)-n:]
+	}
+	return avgs
+}
+
+func streaks(points []trackPoint, now time.Time) (current int, longest int) {
+	days := make([]time.Time, 0, len(points))
+	for _, p := range points {
+		day := atTimeOfDay(p.date, 0)
+		if len(days) == 0 || !days[len(days)-1].Equal(day) {
+			days = append(days, day)
+		}
+	}
+
+	run := 0
+	for i, day := range days {
+		if i > 0 && days[i-1].AddDate(0, 0, 1).Equal(day) {
+			run++
+		} else {
+			run = 1
+		}
+		longest = max(longest, run)
+	}
+
+	today := atTimeOfDay(now, 0)
+	last := days[len(days)-1]
+	if last.Equal(today) || last.AddDate(0, 0, 1).Equal(today) {
+		current = run
+	}
+
+	return current, longest
+}
+
+// Format formats v like the values of the category.
+func (ts *TrackStats) Format(v float64) string {
+	return ts.category.FormatValue(ts.category.fromSixtieths(v))
+}
+
+const (
+	chartWidth  = 300
+	chartHeight = 60
+	chartMargin = 3
+)
+
+// Chart is an svg line chart of the values over time.
+func (ts *TrackStats) Chart() template.HTML {
+	if len(ts.points) < 2 {
+		return ""
+	}
+
+	first, last := ts.points[0].date, ts.points[len(ts.points)-1].date
+	span := last.Sub(first).Seconds()
+	valueSpan := ts.Max - ts.Min
+
+	coords := make([]string, 0, len(ts.points))
+	for _, p := range ts.points {
+		x, y := 0.5, 0.5
+		if span > 0 {
+			x = p.date.Sub(first).Seconds() / span
+		}
+		if valueSpan > 0 {
+			y = (p.value - ts.Min) / valueSpan
+		}
+		coords = append(coords, fmt.Sprintf("%.1f,%.1f",
+			chartMargin+x*(chartWidth-2*chartMargin),
+			chartMargin+(1-y)*(chartHeight-2*chartMargin)))
+	}
+
+	return template.HTML(fmt.Sprintf(`<svg class="chart" viewBox="0 0 %d %d" width="%d" height="%d" role="img" aria-label="%s over time"><polyline fill="none" stroke="currentColor" stroke-width="1.5" points="%s" /></svg>`,
+		chartWidth, chartHeight, chartWidth, chartHeight,
+		template.HTMLEscapeString(ts.Category), strings.Join(coords, " ")))
+}
+
+var trackStatsTemplate = template.Must(template.New("").Funcs(commonFuncs).Parse(`
+{{ define "thing" }}
+<section class="thing track-stats">
+	<h2>{{ .Category }}</h2>
+	{{ if eq .Count 0 }}
+	<p>nothing tracked yet</p>
+	{{ else }}
+	{{ .Chart }}
+	<dl>
+		<dt>count</dt><dd>{{ .Count }}</dd>
+		<dt>min</dt><dd>{{ .Format .Min }}</dd>
+		<dt>max</dt><dd>{{ .Format .Max }}</dd>
+		<dt>mean</dt><dd>{{ .Format .Mean }}</dd>
+		<dt>streak</dt><dd>{{ .CurrentStreak }}d (longest {{ .LongestStreak }}d)</dd>
+	</dl>
+	<table class="averages">
+		<tr><th>week</th><th>mean</th><th>n</th></tr>
+		{{ range .Weekly }}<tr><td>{{ .Label }}</td><td>{{ $.Format .Mean }}</td><td>{{ .Count }}</td></tr>{{ end }}
+	</table>
+	<table class="averages">
+		<tr><th>month</th><th>mean</th><th>n</th></tr>
+		{{ range .Monthly }}<tr><td>{{ .Label }}</td><td>{{ $.Format .Mean }}</td><td>{{ .Count }}</td></tr>{{ end }}
+	</table>
+	{{ end }}
+</section>
+{{ end }}
+`))
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/heyLu/lp/go/things/storage"
+)
+
+func TestTrackStats(t *testing.T) {
+	day := func(d int, hour int) time.Time { return time.Date(2024, 8, d, hour, 0, 0, 0, time.UTC) }
+
+	rows := make([]*storage.Row, 0, 10)
+	for _, v := range []struct {
+		date  time.Time
+		value float64
+	}{
+		// newest first, like storage returns them
+		{day(30, 8), 8},
+		{day(29, 8), 6},
+		{day(28, 8), 7},
+		{day(20, 8), 9},
+		{day(19, 22), 5},
+		{day(19, 8), 7},
+	} {
+		rows = append(rows, &storage.Row{
+			Metadata: storage.Metadata{Kind: "track", DateCreated: v.date},
+			Summary:  "sleep",
+			Float:    sql.NullFloat64{Float64: v.value, Valid: true},
+		})
+	}
+
+	stats := computeTrackStats("sleep", defaultTrackCategories["sleep"], rows, day(31, 12), time.UTC)
+	require.Equal(t, 6, stats.Count)
+	require.Equal(t, 5.0, stats.Min)
+	require.Equal(t, 9.0, stats.Max)
+	require.Equal(t, 7.0, stats.Mean)
+
+	require.Equal(t, []TrackAverage{
+		{Label: "2024-W34", Mean: 7, Count: 3},
+		{Label: "2024-W35", Mean: 7, Count: 3},
+	}, stats.Weekly)
+	require.Equal(t, []TrackAverage{{Label: "2024-08", Mean: 7, Count: 6}}, stats.Monthly)
+
+	require.Equal(t, 3, stats.CurrentStreak)
+	require.Equal(t, 3, stats.LongestStreak)
+	require.Contains(t, string(stats.Chart()), "<polyline")
+
+	// streaks end if there was nothing yesterday or today
+	stats = computeTrackStats("sleep", defaultTrackCategories["sleep"], rows, day(31, 12).AddDate(0, 0, 1), time.UTC)
+	require.Equal(t, 0, stats.CurrentStreak)
+
+	// clock values are averaged in minutes
+	rows = rows[:2]
+	rows[0].Float.Float64, rows[1].Float.Float64 = 7.45, 8.15
+	stats = computeTrackStats("up", defaultTrackCategories["up"], rows, day(31, 12), time.UTC)
+	require.Equal(t, "8:00hrs", stats.Format(stats.Mean))
+	require.Equal(t, "7:45hrs", stats.Format(stats.Min))
+	require.Equal(t, "8:00hrs", stats.Format(stats.Monthly[0].Mean))
+
+	stats = computeTrackStats("sleep", defaultTrackCategories["sleep"], nil, day(31, 12), time.UTC)
+	require.Equal(t, 0, stats.Count)
+	require.Empty(t, stats.Chart())
+}
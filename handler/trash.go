@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/heyLu/lp/go/things/storage"
+)
+
+var _ Handler = TrashHandler{}
+
+// TrashHandler lists deleted things, which can be restored until they are
+// purged.
+type TrashHandler struct{}
+
+func (th TrashHandler) CanHandle(input string) (string, bool) {
+	return "trash", strings.HasPrefix(input, "trash")
+}
+
+func (th TrashHandler) Parse(ctx context.Context, input string) (Thing, error) {
+	return Trash(input), nil
+}
+
+func (th TrashHandler) Query(ctx context.Context, db storage.Storage, namespace string, input string) (storage.Rows, error) {
+	return db.Trash(ctx, namespace)
+}
+
+func (th TrashHandler) Render(ctx context.Context, row *storage.Row) (Renderer, error) {
+	if row.Kind == "trash" {
+		return StringRenderer(""), nil
+	}
+
+	_, handler := All.For(row.Kind)
+	if handler == nil {
+		return nil, fmt.Errorf("no handler for %q", row.Kind)
+	}
+
+	return handler.Render(ctx, row)
+}
+
+type Trash string
+
+func (t Trash) ToRow() *storage.Row {
+	return &storage.Row{
+		Metadata: storage.Metadata{
+			Kind: "trash",
+		},
+	}
+}
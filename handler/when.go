@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultTimeOfDay is used for dates without a time, e.g. `tomorrow`.
+const defaultTimeOfDay = 9 * time.Hour
+
+var (
+	durationRe     = regexp.MustCompile(`^(\d+(\.\d+)?(w|d|h|m|s|ms))+$`)
+	durationPartRe = regexp.MustCompile(`(\d+(?:\.\d+)?)(w|d|h|ms|m|s)`)
+)
+
+var durationUnits = map[string]time.Duration{
+	"minute": time.Minute, "minutes": time.Minute, "min": time.Minute, "mins": time.Minute,
+	"hour": time.Hour, "hours": time.Hour,
+	"day": 24 * time.Hour, "days": 24 * time.Hour,
+	"week": 7 * 24 * time.Hour, "weeks": 7 * 24 * time.Hour,
+}
+
+// ParseWhen parses a time expression at the start of words, returning the
+// time and the number of words it used.  Times are interpreted in the
+// location of now.
+//
+// It understands durations (`30m`, `1d2h`, `in 2 days`), days (`today`,
+// `tomorrow`, `tonight`, `monday`, `next friday`, `next week`, `2024-09-01`)
+// optionally followed by a time of day (`9am`, `14:00`, `at 7:30pm`), and
+// times of day alone, which mean the next time it is that time.
+func ParseWhen(words []string, now time.Time) (time.Time, int, error) {
+	if len(words) == 0 {
+		return time.Time{}, 0, fmt.Errorf("when?")
+	}
+
+	word := strings.ToLower(words[0])
+
+	// durations
+	if dur, ok := parseDuration(word); ok {
+		return now.Add(dur).Truncate(time.Minute), 1, nil
+	}
+	if word == "in" && len(words) > 1 {
+		if dur, ok := parseDuration(strings.ToLower(words[1])); ok {
+			return now.Add(dur).Truncate(time.Minute), 2, nil
+		}
+
+		if len(words) > 2 {
+			count, err := strconv.ParseFloat(words[1], 64)
+			unit, ok := durationUnits[strings.ToLower(words[2])]
+			if err == nil && ok {
+				return now.Add(time.Duration(count * float64(unit))).Truncate(time.Minute), 3, nil
+			}
+		}
+	}
+
+	// times of day alone
+	if at, n, ok := parseAt(words); ok {
+		t := atTimeOfDay(now, at)
+		if !t.After(now) {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, n, nil
+	}
+
+	// days, with an optional time of day
+	day, n, withTime, ok := parseDay(words, now)
+	if !ok {
+		return time.Time{}, 0, fmt.Errorf("don't know when %q is, try e.g. `30m`, `tomorrow 9am` or `2024-09-01 14:00`", words[0])
+	}
+	if withTime {
+		return day, n, nil
+	}
+
+	at := defaultTimeOfDay
+	if word == "tonight" {
+		at = 20 * time.Hour
+	}
+	if explicit, m, ok := parseAt(words[n:]); ok {
+		at = explicit
+		n += m
+	}
+
+	return atTimeOfDay(day, at), n, nil
+}
+
+// parseDuration parses go durations with days and weeks, e.g. `1d2h`.
+func parseDuration(word string) (time.Duration, bool) {
+	if !durationRe.MatchString(word) {
+		return 0, false
+	}
+
+	var dur time.Duration
+	for _, m := range durationPartRe.FindAllStringSubmatch(word, -1) {
+		count, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			return 0, false
+		}
+
+		var unit time.Duration
+		switch m[2] {
+		case "w":
+			unit = 7 * 24 * time.Hour
+		case "d":
+			unit = 24 * time.Hour
+		case "h":
+			unit = time.Hour
+		case "m":
+			unit = time.Minute
+		case "s":
+			unit = time.Second
+		case "ms":
+			unit = time.Millisecond
+		}
+		dur += time.Duration(count * float64(unit))
+	}
+
+	return dur, true
+}
+
+// parseAt parses `9am` or `at 9am` at the start of words.
+func parseAt(words []string) (time.Duration, int, bool) {
+	if len(words) > 1 && strings.ToLower(words[0]) == "at" {
+		at, ok := parseTimeOfDay(words[1])
+		return at, 2, ok
+	}
+
+	if len(words) > 0 {
+		at, ok := parseTimeOfDay(words[0])
+		return at, 1, ok
+	}
+
+	return 0, 0, false
+}
+
+// parseDay parses a day at the start of words, returning midnight of that
+// day in the location of now, or the exact time if words includes one.
+func parseDay(words []string, now time.Time) (day time.Time, n int, withTime bool, ok bool) {
+	today := atTimeOfDay(now, 0)
+
+	// daysUntil is the number of days until the next weekday, a week if it is today
+	daysUntil := func(weekday time.Weekday) int {
+		days := (int(weekday) - int(today.Weekday()) + 7) % 7
+		if days == 0 {
+			days = 7
+		}
+		return days
+	}
+
+	word := strings.ToLower(words[0])
+	switch word {
+	case "today", "tonight":
+		return today, 1, false, true
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), 1, false, true
+	case "next":
+		if len(words) < 2 {
+			return day, 0, false, false
+		}
+
+		next := strings.ToLower(words[1])
+		if next == "week" {
+			return today.AddDate(0, 0, daysUntil(time.Monday)), 2, false, true
+		}
+		if weekday, ok := weekdays[next]; ok {
+			return today.AddDate(0, 0, daysUntil(weekday)), 2, false, true
+		}
+
+		return day, 0, false, false
+	}
+
+	if weekday, ok := weekdays[word]; ok {
+		// today only if that time has not passed yet
+		if today.Weekday() == weekday {
+			at, _, ok := parseAt(words[1:])
+			if !ok {
+				at = defaultTimeOfDay
+			}
+			if atTimeOfDay(today, at).After(now) {
+				return today, 1, false, true
+			}
+		}
+		return today.AddDate(0, 0, daysUntil(weekday)), 1, false, true
+	}
+
+	t, err := time.ParseInLocation("2006-01-02T15:04", words[0], now.Location())
+	if err == nil {
+		return t, 1, true, true
+	}
+
+	t, err = time.ParseInLocation("2006-01-02", words[0], now.Location())
+	if err == nil {
+		return t, 1, false, true
+	}
+
+	return day, 0, false, false
+}
+
+// atTimeOfDay returns the day of t at the wall clock time at, which is not
+// at after midnight on days when DST changes.
+func atTimeOfDay(t time.Time, at time.Duration) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, int(at/time.Hour), int(at%time.Hour/time.Minute), 0, 0, t.Location())
+}
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseWhen(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	// a saturday
+	now := time.Date(2024, 8, 31, 10, 30, 20, 0, berlin)
+
+	for _, tc := range []struct {
+		input string
+		want  time.Time
+		rest  string
+	}{
+		{"30m stretch", time.Date(2024, 8, 31, 11, 0, 0, 0, berlin), "stretch"},
+		{"1d2h call bank", time.Date(2024, 9, 1, 12, 30, 0, 0, berlin), "call bank"},
+		{"in 2 days call bank", time.Date(2024, 9, 2, 10, 30, 0, 0, berlin), "call bank"},
+		{"tomorrow 9am call bank", time.Date(2024, 9, 1, 9, 0, 0, 0, berlin), "call bank"},
+		{"tomorrow call bank", time.Date(2024, 9, 1, 9, 0, 0, 0, berlin), "call bank"},
+		{"tonight go to bed", time.Date(2024, 8, 31, 20, 0, 0, 0, berlin), "go to bed"},
+		{"2024-09-01 14:00 dentist", time.Date(2024, 9, 1, 14, 0, 0, 0, berlin), "dentist"},
+		{"2024-09-01T14:00 dentist", time.Date(2024, 9, 1, 14, 0, 0, 0, berlin), "dentist"},
+		{"monday at 7:30pm gym", time.Date(2024, 9, 2, 19, 30, 0, 0, berlin), "gym"},
+		{"saturday 11:00 today", time.Date(2024, 8, 31, 11, 0, 0, 0, berlin), "today"},
+		{"saturday 10:00 next week", time.Date(2024, 9, 7, 10, 0, 0, 0, berlin), "next week"},
+		{"next saturday", time.Date(2024, 9, 7, 9, 0, 0, 0, berlin), ""},
+		{"next week plan", time.Date(2024, 9, 2, 9, 0, 0, 0, berlin), "plan"},
+		{"9:00 later", time.Date(2024, 9, 1, 9, 0, 0, 0, berlin), "later"},
+		{"22:00 later", time.Date(2024, 8, 31, 22, 0, 0, 0, berlin), "later"},
+	} {
+		words := strings.Fields(tc.input)
+		got, n, err := ParseWhen(words, now)
+		require.NoError(t, err, tc.input)
+		require.Equal(t, tc.want, got, tc.input)
+		require.Equal(t, tc.rest, strings.Join(words[n:], " "), tc.input)
+	}
+
+	// the saturdays before DST starts and ends
+	for _, now := range []time.Time{time.Date(2024, 3, 30, 10, 0, 0, 0, berlin), time.Date(2024, 10, 26, 10, 0, 0, 0, berlin)} {
+		for input, hour := range map[string]int{"tomorrow 9am": 9, "tomorrow 20:00": 20, "sunday": 9} {
+			got, _, err := ParseWhen(strings.Fields(input), now)
+			require.NoError(t, err, input)
+			require.Equal(t, time.Date(now.Year(), now.Month(), now.Day()+1, hour, 0, 0, 0, berlin), got, "%s on %s", input, now)
+		}
+	}
+
+	for _, input := range []string{"someday", "next", "25:00", "13pm"} {
+		_, _, err := ParseWhen(strings.Fields(input), now)
+		require.Error(t, err, input)
+	}
+}
@@ -0,0 +1,134 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/heyLu/lp/go/things/storage"
+)
+
+// Notifier is told about things that are due, e.g. reminders.
+type Notifier interface {
+	Notify(ctx context.Context, row *storage.Row) error
+}
+
+// Notifiers notifies all of its notifiers, even if some of them fail.
+type Notifiers []Notifier
+
+func (ns Notifiers) Notify(ctx context.Context, row *storage.Row) error {
+	var errs []error
+	for _, n := range ns {
+		err := n.Notify(ctx, row)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+var _ Notifier = LogNotifier{}
+
+type LogNotifier struct{}
+
+func (ln LogNotifier) Notify(ctx context.Context, row *storage.Row) error {
+	log.Printf("%s/%s/%d due: %s", row.Namespace, row.Kind, row.ID, row.Summary)
+	return nil
+}
+
+var _ Notifier = &WebhookNotifier{}
+
+// webhookClient is used if a [WebhookNotifier] has no client, so that hung
+// webhooks don't block the scheduler.
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// WebhookNotifier POSTs the row as json to URL.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+type webhookPayload struct {
+	Namespace string    `json:"namespace"`
+	Kind      string    `json:"kind"`
+	ID        int64     `json:"id"`
+	Summary   string    `json:"summary"`
+	Time      time.Time `json:"time"`
+	Tags      []string  `json:"tags"`
+}
+
+func (wn *WebhookNotifier) Notify(ctx context.Context, row *storage.Row) error {
+	body, err := json.Marshal(webhookPayload{
+		Namespace: row.Namespace,
+		Kind:      row.Kind,
+		ID:        row.ID,
+		Summary:   row.Summary,
+		Time:      row.Time.Time,
+		Tags:      row.Tags,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wn.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := wn.Client
+	if client == nil {
+		client = webhookClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s: %s", wn.URL, resp.Status)
+	}
+
+	return nil
+}
+
+var _ Notifier = CommandNotifier("")
+
+// CommandNotifier runs a command with the summary as the last argument, e.g.
+// "notify-send things" runs `notify-send things <summary>`.
+//
+// The namespace, kind, id and time are available as THINGS_* environment variables.
+type CommandNotifier string
+
+func (cn CommandNotifier) Notify(ctx context.Context, row *storage.Row) error {
+	args := strings.Fields(string(cn))
+	if len(args) == 0 {
+		return fmt.Errorf("empty command")
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], append(args[1:], row.Summary)...)
+	cmd.Env = append(os.Environ(),
+		"THINGS_NAMESPACE="+row.Namespace,
+		"THINGS_KIND="+row.Kind,
+		"THINGS_ID="+strconv.FormatInt(row.ID, 10),
+		"THINGS_TIME="+row.Time.Time.Format(time.RFC3339),
+	)
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %w: %s", args[0], err, out)
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/heyLu/lp/go/things/handler"
+	"github.com/heyLu/lp/go/things/notify"
+	"github.com/heyLu/lp/go/things/storage"
+)
+
+// Scheduler fires reminders once they are due, archives things that were
+// done a while ago and purges old things from the trash.
+//
+// Fired reminders have their Bool set, so they are only dispatched once.
+// Repeating reminders get a new reminder for their next occurrence.
+//
+// Tasks and later things are archived once they were done for as many days
+// as the `archive` setting of their namespace says.
+type Scheduler struct {
+	storage  storage.Storage
+	notifier notify.Notifier
+	interval time.Duration
+
+	// trashRetention is how long deleted things are kept, forever if 0
+	trashRetention time.Duration
+}
+
+// notifyTimeout is how long notifying about one thing may take, so that a
+// hung notifier doesn't hold up everything else the scheduler does.
+const notifyTimeout = 30 * time.Second
+
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		err := s.fireDue(ctx, time.Now())
+		if err != nil {
+			log.Printf("scheduler: %s", err)
+		}
+
+		if s.trashRetention > 0 {
+			n, err := s.storage.Purge(ctx, time.Now().Add(-s.trashRetention))
+			if err != nil {
+				log.Printf("scheduler: purge: %s", err)
+			}
+			if n > 0 {
+				log.Printf("scheduler: purged %d things from the trash", n)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) fireDue(ctx context.Context, now time.Time) error {
+	namespaces, err := s.storage.Namespaces(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, namespace := range namespaces {
+		err := s.fireDueIn(ctx, namespace, now)
+		if err != nil {
+			log.Printf("scheduler: %s: %s", namespace, err)
+		}
+	}
+
+	return nil
+}
+
+// fireDueIn fires the due reminders of namespace and archives its things, so
+// that errors in one namespace don't hold up the others.
+func (s *Scheduler) fireDueIn(ctx context.Context, namespace string, now time.Time) error {
+	settings, err := handler.LoadSettings(ctx, s.storage, namespace)
+	if err != nil {
+		return err
+	}
+	ctx = handler.WithSettings(ctx, settings)
+
+	due, err := s.due(ctx, namespace, now)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range due {
+		row.Bool = sql.NullBool{Bool: true, Valid: true}
+		err := update(ctx, s.storage, row)
+		if err != nil {
+			return err
+		}
+
+		notifyCtx, cancel := context.WithTimeout(ctx, notifyTimeout)
+		err = s.notifier.Notify(notifyCtx, row)
+		cancel()
+		if err != nil {
+			log.Printf("scheduler: notify %s/%s/%d: %s", row.Namespace, row.Kind, row.ID, err)
+		}
+	}
+
+	return s.archive(ctx, namespace, now)
+}
+
+func (s *Scheduler) archive(ctx context.Context, namespace string, now time.Time) error {
+	days, err := strconv.Atoi(handler.SettingsFrom(ctx)["archive"])
+	if err != nil || days <= 0 {
+		return nil
+	}
+
+	rows, err := s.storage.Query(ctx, namespace,
+		storage.Or(storage.Kind("task"), storage.Kind("later")),
+		storage.Is("bool", true),
+		storage.Lt("date_modified", now.AddDate(0, 0, -days).UTC().Unix()),
+		storage.Not(storage.Field("archived", true)),
+	)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	done := make([]*storage.Row, 0, 1)
+	for rows.Next() {
+		var row storage.Row
+		err := rows.Scan(&row)
+		if err != nil {
+			return err
+		}
+		done = append(done, &row)
+	}
+	rows.Close()
+
+	for _, row := range done {
+		err := s.storage.SetField(ctx, row.Namespace, row.Kind, row.ID, "archived", true)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Scheduler) due(ctx context.Context, namespace string, now time.Time) ([]*storage.Row, error) {
+	rows, err := s.storage.Query(ctx, namespace,
+		storage.Kind("reminder"),
+		storage.Lt("time", now.UTC().Unix()+1),
+		storage.Not(storage.Is("bool", true)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	due := make([]*storage.Row, 0, 1)
+	for rows.Next() {
+		var row storage.Row
+		err := rows.Scan(&row)
+		if err != nil {
+			return nil, err
+		}
+		due = append(due, &row)
+	}
+
+	return due, nil
+}
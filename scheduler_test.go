@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/heyLu/lp/go/things/storage"
+)
+
+type recordingNotifier struct {
+	rows []*storage.Row
+}
+
+func (rn *recordingNotifier) Notify(ctx context.Context, row *storage.Row) error {
+	rn.rows = append(rn.rows, row)
+	return nil
+}
+
+// brokenStorage fails all queries in one namespace.
+type brokenStorage struct {
+	storage.Storage
+	namespace string
+}
+
+func (bs brokenStorage) Query(ctx context.Context, namespace string, conditions ...storage.Condition) (storage.Rows, error) {
+	if namespace == bs.namespace {
+		return nil, errors.New("broken")
+	}
+	return bs.Storage.Query(ctx, namespace, conditions...)
+}
+
+func TestSchedulerFireDue(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.NewDBStorage(ctx, ":memory:")
+	require.NoError(t, err)
+
+	now := time.Now()
+	for _, namespace := range []string{"a", "b"} {
+		require.NoError(t, db.Insert(ctx, &storage.Row{
+			Metadata: storage.Metadata{Namespace: namespace, Kind: "reminder"},
+			Summary:  "call bank",
+			Time:     sql.NullTime{Time: now.Add(-time.Minute), Valid: true},
+		}))
+	}
+
+	notifier := &recordingNotifier{}
+	scheduler := &Scheduler{storage: brokenStorage{Storage: db, namespace: "a"}, notifier: notifier}
+	require.NoError(t, scheduler.fireDue(ctx, now))
+
+	require.Len(t, notifier.rows, 1)
+	require.Equal(t, "b", notifier.rows[0].Namespace)
+
+	row, err := db.Find(ctx, "b", strconv.FormatInt(notifier.rows[0].ID, 10))
+	require.NoError(t, err)
+	require.True(t, row.Bool.Bool)
+
+	// fired reminders are only dispatched once
+	require.NoError(t, scheduler.fireDue(ctx, now))
+	require.Len(t, notifier.rows, 1)
+}
+
+func TestSchedulerArchive(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.NewDBStorage(ctx, ":memory:")
+	require.NoError(t, err)
+
+	insert := func(kind string, summary string, done bool) *storage.Row {
+		row := &storage.Row{
+			Metadata: storage.Metadata{Namespace: "test", Kind: kind},
+			Summary:  summary,
+			Bool:     sql.NullBool{Valid: true},
+		}
+		require.NoError(t, db.Insert(ctx, row))
+		if done {
+			row.Bool.Bool = true
+			require.NoError(t, db.Update(ctx, row))
+		}
+		return row
+	}
+
+	require.NoError(t, db.Insert(ctx, &storage.Row{
+		Metadata: storage.Metadata{Namespace: "test", Kind: "setting"},
+		Summary:  "archive",
+		Content:  sql.NullString{String: "30", Valid: true},
+	}))
+	done := insert("task", "fix bike", true)
+	insert("task", "buy bread", false)
+	insert("later", "read article", true)
+	insert("reminder", "call bank", true)
+
+	before, err := db.Find(ctx, "test", strconv.FormatInt(done.ID, 10))
+	require.NoError(t, err)
+
+	scheduler := &Scheduler{storage: db, notifier: &recordingNotifier{}}
+
+	// not done long enough
+	require.NoError(t, scheduler.fireDue(ctx, time.Now().AddDate(0, 0, 29)))
+	rows, err := db.Query(ctx, "test", storage.Field("archived", true))
+	require.NoError(t, err)
+	require.False(t, rows.Next())
+	rows.Close()
+
+	require.NoError(t, scheduler.fireDue(ctx, time.Now().AddDate(0, 0, 31)))
+	rows, err = db.Query(ctx, "test", storage.Field("archived", true))
+	require.NoError(t, err)
+	archived := []string{}
+	for rows.Next() {
+		var row storage.Row
+		require.NoError(t, rows.Scan(&row))
+		archived = append(archived, row.Kind)
+	}
+	rows.Close()
+	require.ElementsMatch(t, []string{"task", "later"}, archived)
+
+	// archiving is not an edit
+	row, err := db.Find(ctx, "test", strconv.FormatInt(done.ID, 10))
+	require.NoError(t, err)
+	require.Equal(t, before.DateModified.Unix(), row.DateModified.Unix())
+	revisions, err := db.History(ctx, "test", "task", done.ID)
+	require.NoError(t, err)
+	require.Empty(t, revisions)
+}
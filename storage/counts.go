@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// DayCount is the number of things of a kind created on a day.
+type DayCount struct {
+	// Date is the day in the location of the range, like 2024-08-15
+	Date  string
+	Kind  string
+	Count int
+}
+
+// CountCreated counts the things created from from until to, by the day they
+// were created in the location of from and their kind.
+func (dbs *dbStorage) CountCreated(ctx context.Context, namespace string, from time.Time, to time.Time) ([]DayCount, error) {
+	date, dateArgs := localDate("date_created", from, to)
+
+	queryArgs := append(dateArgs, namespace, from.Unix(), to.Unix())
+	rows, err := dbs.db.QueryContext(ctx, "SELECT "+date+" AS day, kind, count(*) FROM things_v2 WHERE namespace = ? AND date_deleted IS NULL AND date_created >= ? AND date_created < ? GROUP BY day, kind ORDER BY day, kind", queryArgs...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make([]DayCount, 0, 31)
+	for rows.Next() {
+		var count DayCount
+		err := rows.Scan(&count.Date, &count.Kind, &count.Count)
+		if err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+
+	return counts, rows.Err()
+}
+
+// localDate returns an expression for the date of the unix timestamps in
+// column, in the location of from.  sqlite only knows utc offsets, so there
+// is one for every change of the offset until to, e.g. for daylight saving
+// time.
+func localDate(column string, from time.Time, to time.Time) (string, []any) {
+	date := "date(" + column + " + ?, 'unixepoch')"
+
+	var expr strings.Builder
+	args := make([]any, 0, 3)
+	for t := from; ; {
+		_, offset := t.Zone()
+		_, end := t.ZoneBounds()
+		if end.IsZero() || !end.Before(to) {
+			if expr.Len() == 0 {
+				return date, []any{offset}
+			}
+			expr.WriteString(" ELSE " + date + " END")
+			args = append(args, offset)
+			return "CASE" + expr.String(), args
+		}
+
+		expr.WriteString(" WHEN " + column + " < ? THEN " + date)
+		args = append(args, end.Unix(), offset)
+		t = end
+	}
+}
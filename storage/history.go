@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Revision is a prior version of a thing, numbered from 1 for the oldest one.
+type Revision struct {
+	Row
+
+	Revision int64
+}
+
+// recordRevision copies the current version of a thing to things_history,
+// before it is changed to row by an update.  Nothing is recorded if only
+// whether it is done changes, e.g. when marking a task as done.
+func recordRevision(ctx context.Context, tx *sql.Tx, row *Row, timeValue sql.NullInt64, fieldsJSON []byte) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO things_history (namespace, kind, id, revision, summary, content, ref, number, float, bool, time, fields_json, tags, date_created, date_modified)
+		SELECT namespace, kind, id,
+			(SELECT coalesce(max(revision), 0) + 1 FROM things_history WHERE namespace = ? AND kind = ? AND id = ?),
+			summary, content, ref, number, float, bool, time, fields_json, tags, date_created, date_modified
+		FROM things_v2 WHERE namespace = ? AND kind = ? AND id = ? AND date_deleted IS NULL
+			AND NOT (summary IS ? AND content IS ? AND ref IS ? AND number IS ? AND float IS ? AND time IS ? AND fields_json IS ?)`,
+		row.Namespace, row.Kind, row.ID, row.Namespace, row.Kind, row.ID,
+		row.Summary, row.Content, row.Ref, row.Number, row.Float, timeValue, fieldsJSON)
+	return err
+}
+
+// History returns the prior versions of a thing, newest first.
+func (dbs *dbStorage) History(ctx context.Context, namespace string, kind string, id int64) ([]Revision, error) {
+	rows, err := dbs.db.QueryContext(ctx, `SELECT namespace, kind, id, summary, content, ref, number, float, bool, time, json(fields_json), tags, date_created, date_modified, NULL, revision
+		FROM things_history WHERE namespace = ? AND kind = ? AND id = ? ORDER BY revision DESC`,
+		namespace, kind, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revision int64
+	dbRows := &dbRows{rows: rows, extra: []any{&revision}}
+
+	revisions := make([]Revision, 0, 5)
+	for dbRows.Next() {
+		var rev Revision
+		err := dbRows.Scan(&rev.Row)
+		if err != nil {
+			return nil, err
+		}
+		rev.Revision = revision
+
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, rows.Err()
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// wikiLinkRe matches links to other things, like `[[note title]]` or
+// `[[task/1724567890]]`.
+var wikiLinkRe = regexp.MustCompile(`\[\[([^\[\]\n]+)\]\]`)
+
+// Links returns the targets of the links in the summary and content of row.
+func Links(row *Row) []string {
+	links := make([]string, 0, 2)
+	for _, m := range wikiLinkRe.FindAllStringSubmatch(row.Summary+"\n"+row.Content.String, -1) {
+		target := strings.TrimSpace(m[1])
+		if !slices.Contains(links, target) {
+			links = append(links, target)
+		}
+	}
+	return links
+}
+
+// LinksTo matches things that link to one of targets, see [Links].
+func LinksTo(targets ...string) Condition {
+	args := make([]any, 0, len(targets))
+	for _, target := range targets {
+		args = append(args, target)
+	}
+	return Condition{
+		expr: "EXISTS (SELECT 1 FROM things_links WHERE things_links.namespace = things_v2.namespace AND things_links.kind = things_v2.kind AND things_links.id = things_v2.id AND things_links.target IN (?" + strings.Repeat(", ?", len(targets)-1) + "))",
+		args: args,
+	}
+}
+
+// createLinks creates the things_links table, with one row per link of each
+// thing, filling it from things_v2.
+func createLinks(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, "CREATE TABLE things_links (namespace TEXT NOT NULL, kind TEXT NOT NULL, id INTEGER NOT NULL, target TEXT NOT NULL, PRIMARY KEY (namespace, target, kind, id))")
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "CREATE INDEX things_links_thing ON things_links (namespace, kind, id)")
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT namespace, kind, id, summary, content FROM things_v2 WHERE date_deleted IS NULL AND (summary LIKE '%[[%' OR content LIKE '%[[%')")
+	if err != nil {
+		return err
+	}
+
+	all := make([]*Row, 0, 10)
+	for rows.Next() {
+		var row Row
+		err := rows.Scan(&row.Namespace, &row.Kind, &row.ID, &row.Summary, &row.Content)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		all = append(all, &row)
+	}
+	err = rows.Close()
+	if err != nil {
+		return err
+	}
+
+	for _, row := range all {
+		err := setLinks(ctx, tx, row)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setLinks replaces the links of row in things_links.
+func setLinks(ctx context.Context, tx *sql.Tx, row *Row) error {
+	_, err := tx.ExecContext(ctx, "DELETE FROM things_links WHERE namespace = ? AND kind = ? AND id = ?", row.Namespace, row.Kind, row.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range Links(row) {
+		_, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO things_links (namespace, kind, id, target) VALUES (?, ?, ?, ?)", row.Namespace, row.Kind, row.ID, target)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
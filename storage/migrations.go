@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type migration struct {
+	name    string
+	migrate func(ctx context.Context, tx *sql.Tx) error
+}
+
+func execMigration(query string) func(ctx context.Context, tx *sql.Tx) error {
+	return func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, query)
+		return err
+	}
+}
+
+// migrations are run in order, each at most once, see [migrate].
+//
+// Only ever append to this list, the index of a migration is its version.
+// The first migrations use IF NOT EXISTS because they ran ad hoc on every
+// start before there were migrations.
+var migrations = []migration{
+	{"create things_v2", execMigration("CREATE TABLE IF NOT EXISTS things_v2 (namespace TEXT NOT NULL, kind TEXT NOT NULL, id INTEGER NOT NULL, summary TEXT NOT NULL, content TEXT, ref TEXT, number INTEGER, float REAL, bool INTEGER, time INTEGER, fields_json BLOB, tags TEXT NOT NULL, date_created INTEGER NOT NULL, date_modified INTEGER NOT NULL, PRIMARY KEY (namespace, kind, id))")},
+	{"add things_v2.date_deleted", func(ctx context.Context, tx *sql.Tx) error {
+		return addColumn(ctx, tx, "things_v2", "date_deleted", "INTEGER")
+	}},
+	{"create things_history", execMigration("CREATE TABLE IF NOT EXISTS things_history (namespace TEXT NOT NULL, kind TEXT NOT NULL, id INTEGER NOT NULL, revision INTEGER NOT NULL, summary TEXT NOT NULL, content TEXT, ref TEXT, number INTEGER, float REAL, bool INTEGER, time INTEGER, fields_json BLOB, tags TEXT NOT NULL, date_created INTEGER NOT NULL, date_modified INTEGER NOT NULL, PRIMARY KEY (namespace, kind, id, revision))")},
+	{"create things_tags", createTags},
+	{"migrate legacy things to things_v2", migrateLegacyThings},
+	{"index things_v2 by date_created", execMigration("CREATE INDEX IF NOT EXISTS things_v2_date_created ON things_v2 (namespace, date_created)")},
+	{"create exchange_rates", execMigration("CREATE TABLE exchange_rates (base TEXT NOT NULL, quote TEXT NOT NULL, rate REAL NOT NULL, date INTEGER NOT NULL, PRIMARY KEY (base, quote))")},
+	{"create things_links", createLinks},
+}
+
+// migrate brings the schema up to date, recording the number of migrations
+// that ran in schema_version.
+func migrate(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)")
+	if err != nil {
+		return err
+	}
+
+	var version int
+	err = db.QueryRowContext(ctx, "SELECT coalesce(max(version), 0) FROM schema_version").Scan(&version)
+	if err != nil {
+		return err
+	}
+
+	if version > len(migrations) {
+		return fmt.Errorf("schema version %d is newer than the %d known migrations", version, len(migrations))
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+
+		err = migrations[i].migrate(ctx, tx)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d (%s): %w", i+1, migrations[i].name, err)
+		}
+
+		_, err = tx.ExecContext(ctx, "DELETE FROM schema_version")
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, "INSERT INTO schema_version (version) VALUES (?)", i+1)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addColumn adds column to table unless it exists already.
+func addColumn(ctx context.Context, tx *sql.Tx, table string, column string, typ string) error {
+	var exists bool
+	err := tx.QueryRowContext(ctx, "SELECT count(*) > 0 FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, typ))
+	return err
+}
+
+// migrateLegacyThings copies things from the legacy things table to
+// things_v2 and then drops it.
+//
+// value1 becomes the summary and value2 the content, and all values are kept
+// in the fields as value1..value9.  Things whose id is taken already in
+// things_v2 get a new one.
+func migrateLegacyThings(ctx context.Context, tx *sql.Tx) error {
+	var exists bool
+	err := tx.QueryRowContext(ctx, "SELECT count(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'things'").Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return nil
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT coalesce(namespace, ''), coalesce(kind, ''), coalesce(tags, ''), coalesce(date_created, 0), coalesce(date_modified, 0), coalesce(id, 0), value1, value2, value3, value4, value5, value6, value7, value8, value9 FROM things")
+	if err != nil {
+		return err
+	}
+
+	type legacyThing struct {
+		namespace, kind, tags     string
+		dateCreated, dateModified int64
+		id                        int64
+		values                    [9]sql.NullString
+	}
+	things := make([]legacyThing, 0, 10)
+	for rows.Next() {
+		var thing legacyThing
+		dest := []any{&thing.namespace, &thing.kind, &thing.tags, &thing.dateCreated, &thing.dateModified, &thing.id}
+		for i := range thing.values {
+			dest = append(dest, &thing.values[i])
+		}
+
+		err := rows.Scan(dest...)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		things = append(things, thing)
+	}
+	err = rows.Close()
+	if err != nil {
+		return err
+	}
+
+	for _, thing := range things {
+		if thing.namespace == "" || thing.kind == "" {
+			continue
+		}
+
+		fields := make(map[string]any, len(thing.values))
+		for i, value := range thing.values {
+			if value.Valid {
+				fields[fmt.Sprintf("value%d", i+1)] = value.String
+			}
+		}
+		fieldsJSON, err := json.Marshal(fields)
+		if err != nil {
+			return err
+		}
+
+		var taken bool
+		err = tx.QueryRowContext(ctx, "SELECT count(*) > 0 FROM things_v2 WHERE namespace = ? AND id = ?", thing.namespace, thing.id).Scan(&taken)
+		if err != nil {
+			return err
+		}
+
+		var id int64
+		err = tx.QueryRowContext(ctx, `INSERT INTO things_v2 (namespace, kind, id, summary, content, fields_json, tags, date_created, date_modified)
+			SELECT ?, ?, CASE WHEN ? OR ? <= 0 THEN coalesce(max(id), 0) + 1 ELSE ? END, ?, ?, ?, ?, ?, ? FROM things_v2 WHERE namespace = ?
+			RETURNING id`,
+			thing.namespace, thing.kind, taken, thing.id, thing.id,
+			thing.values[0].String, thing.values[1], fieldsJSON,
+			thing.tags, thing.dateCreated, thing.dateModified,
+			thing.namespace,
+		).Scan(&id)
+		if err != nil {
+			return err
+		}
+
+		err = setTags(ctx, tx, thing.namespace, thing.kind, id, strings.Split(thing.tags, ","))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "DROP TABLE things")
+	return err
+}
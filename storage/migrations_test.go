@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateLegacyThings(t *testing.T) {
+	ctx := context.Background()
+	dsn := "file:" + filepath.Join(t.TempDir(), "things.db")
+
+	db, err := sql.Open("sqlite3", dsn)
+	require.NoError(t, err)
+
+	_, err = db.Exec("CREATE TABLE things (namespace TEXT, kind TEXT, tags TEXT, date_created INT, date_modified INT, id INT, value1 TEXT, value2 TEXT, value3 TEXT, value4 TEXT, value5 TEXT, value6 TEXT, value7 TEXT, value8 TEXT, value9 TEXT)")
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE things_v2 (namespace TEXT NOT NULL, kind TEXT NOT NULL, id INTEGER NOT NULL, summary TEXT NOT NULL, content TEXT, ref TEXT, number INTEGER, float REAL, bool INTEGER, time INTEGER, fields_json BLOB, tags TEXT NOT NULL, date_created INTEGER NOT NULL, date_modified INTEGER NOT NULL, PRIMARY KEY (namespace, kind, id))")
+	require.NoError(t, err)
+
+	_, err = db.Exec("INSERT INTO things VALUES ('test', 'note', '#old', ?, 0, 1, 'an old note', 'with content', NULL, 'more', NULL, NULL, NULL, NULL, NULL)", ourEpoch.Unix())
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO things VALUES ('test', 'note', '', ?, 0, 2, 'a colliding note', NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL)", ourEpoch.Unix())
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO things_v2 VALUES ('test', 'task', 2, 'a new task', NULL, NULL, NULL, NULL, NULL, NULL, NULL, '', ?, 0)", ourEpoch.Unix())
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	st, err := NewDBStorage(ctx, dsn)
+	require.NoError(t, err)
+	defer st.Close()
+
+	var version int
+	require.NoError(t, st.(*dbStorage).db.QueryRow("SELECT version FROM schema_version").Scan(&version))
+	require.Equal(t, len(migrations), version)
+
+	var legacy int
+	require.NoError(t, st.(*dbStorage).db.QueryRow("SELECT count(*) FROM sqlite_master WHERE name = 'things'").Scan(&legacy))
+	require.Equal(t, 0, legacy)
+
+	row, err := st.Find(ctx, "test", 1)
+	require.NoError(t, err)
+	require.Equal(t, "an old note", row.Summary)
+	require.Equal(t, "with content", row.Content.String)
+	require.Equal(t, map[string]any{"value1": "an old note", "value2": "with content", "value4": "more"}, row.Fields)
+	require.Equal(t, ourEpoch, row.DateCreated)
+
+	row, err = st.Find(ctx, "test", 3)
+	require.NoError(t, err)
+	require.Equal(t, "a colliding note", row.Summary)
+
+	counts, err := st.TagCounts(ctx, "test")
+	require.NoError(t, err)
+	require.Equal(t, []TagCount{{"#old", 1}}, counts)
+
+	// migrating again is a no-op
+	require.NoError(t, st.Close())
+	st, err = NewDBStorage(ctx, dsn)
+	require.NoError(t, err)
+	defer st.Close()
+}
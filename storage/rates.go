@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// Rate is an exchange rate, 1 Base is Rate Quote on Date.
+type Rate struct {
+	Base  string
+	Quote string
+	Rate  float64
+	Date  time.Time
+}
+
+// SetRates stores rates, keeping the existing rate for a currency pair if it
+// is newer.
+func (dbs *dbStorage) SetRates(ctx context.Context, rates []Rate) error {
+	tx, err := dbs.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, rate := range rates {
+		_, err := tx.ExecContext(ctx, `INSERT INTO exchange_rates (base, quote, rate, date) VALUES (?, ?, ?, ?)
+			ON CONFLICT (base, quote) DO UPDATE SET rate = excluded.rate, date = excluded.date WHERE excluded.date >= exchange_rates.date`,
+			rate.Base, rate.Quote, rate.Rate, rate.Date.UTC().Unix())
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Rates returns all exchange rates, sorted by currency pair.
+func (dbs *dbStorage) Rates(ctx context.Context) ([]Rate, error) {
+	rows, err := dbs.db.QueryContext(ctx, "SELECT base, quote, rate, date FROM exchange_rates ORDER BY base, quote")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := make([]Rate, 0, 32)
+	for rows.Next() {
+		var rate Rate
+		var date int64
+		err := rows.Scan(&rate.Base, &rate.Quote, &rate.Rate, &date)
+		if err != nil {
+			return nil, err
+		}
+		rate.Date = time.Unix(date, 0).UTC()
+		rates = append(rates, rate)
+	}
+
+	return rates, rows.Err()
+}
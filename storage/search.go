@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+// SnippetStart and SnippetEnd enclose matches in [Row.Snippet].
+const (
+	SnippetStart = "\x02"
+	SnippetEnd   = "\x03"
+)
+
+// ftsAvailable reports whether sqlite was built with fts5 (the sqlite_fts5
+// build tag).  Without it Search falls back to LIKE queries.
+func ftsAvailable(ctx context.Context, db *sql.DB) (bool, error) {
+	var available bool
+	err := db.QueryRowContext(ctx, "SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&available)
+	return available, err
+}
+
+var ftsTriggers = []string{"things_fts_insert", "things_fts_update", "things_fts_delete"}
+
+// checkFTSTriggers fails if the database was used with fts5 before, because
+// the triggers that keep the index in sync would fail without it.
+func checkFTSTriggers(ctx context.Context, db *sql.DB) error {
+	var synced bool
+	err := db.QueryRowContext(ctx, "SELECT count(*) > 0 FROM sqlite_master WHERE type = 'trigger' AND name = ?", ftsTriggers[0]).Scan(&synced)
+	if err != nil {
+		return err
+	}
+	if synced {
+		return errors.New("database is indexed with fts5, but sqlite was built without it (use -tags sqlite_fts5)")
+	}
+	return nil
+}
+
+// createFTS creates the things_fts table and the triggers that keep it in
+// sync with things_v2, filling it if it is new or was not kept in sync.
+//
+// This is not a migration because it depends on the build.
+func createFTS(ctx context.Context, db *sql.DB) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var inSync bool
+	err = tx.QueryRowContext(ctx, "SELECT count(*) > 0 FROM sqlite_master WHERE type = 'trigger' AND name = ?", ftsTriggers[0]).Scan(&inSync)
+	if err != nil {
+		return err
+	}
+
+	if inSync {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, "CREATE VIRTUAL TABLE IF NOT EXISTS things_fts USING fts5(summary, content, tags, ref, namespace UNINDEXED, kind UNINDEXED, id UNINDEXED)")
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM things_fts")
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO things_fts (summary, content, tags, ref, namespace, kind, id) SELECT summary, content, tags, ref, namespace, kind, id FROM things_v2")
+	if err != nil {
+		return err
+	}
+
+	triggers := []string{
+		`CREATE TRIGGER things_fts_insert AFTER INSERT ON things_v2 BEGIN
+			INSERT INTO things_fts (summary, content, tags, ref, namespace, kind, id) VALUES (new.summary, new.content, new.tags, new.ref, new.namespace, new.kind, new.id);
+		END`,
+		`CREATE TRIGGER things_fts_update AFTER UPDATE ON things_v2 BEGIN
+			DELETE FROM things_fts WHERE namespace = old.namespace AND kind = old.kind AND id = old.id;
+			INSERT INTO things_fts (summary, content, tags, ref, namespace, kind, id) VALUES (new.summary, new.content, new.tags, new.ref, new.namespace, new.kind, new.id);
+		END`,
+		`CREATE TRIGGER things_fts_delete AFTER DELETE ON things_v2 BEGIN
+			DELETE FROM things_fts WHERE namespace = old.namespace AND kind = old.kind AND id = old.id;
+		END`,
+	}
+	for _, trigger := range triggers {
+		_, err := tx.ExecContext(ctx, trigger)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Search returns rows matching all of the terms, best matches first.
+func (dbs *dbStorage) Search(ctx context.Context, namespace string, terms string, conditions ...Condition) (Rows, error) {
+	words := strings.Fields(terms)
+	if len(words) == 0 {
+		return dbs.Query(ctx, namespace, conditions...)
+	}
+
+	if !dbs.fts {
+		for _, word := range words {
+			conditions = append(conditions, Or(Match("summary", word), Match("content", word), Match("tags", word)))
+		}
+		return dbs.Query(ctx, namespace, conditions...)
+	}
+
+	var query strings.Builder
+	query.WriteString(`SELECT ` + selectColumns + `, fts_snippet FROM things_v2
+		JOIN (SELECT namespace AS fts_namespace, kind AS fts_kind, id AS fts_id, rank AS fts_rank, snippet(things_fts, -1, ?, ?, '…', 12) AS fts_snippet FROM things_fts WHERE things_fts MATCH ?)
+		ON namespace = fts_namespace AND kind = fts_kind AND id = fts_id
+		WHERE namespace = ? AND date_deleted IS NULL`)
+	queryArgs := []any{SnippetStart, SnippetEnd, ftsQuery(words), namespace}
+
+	for _, condition := range conditions {
+		query.WriteString(" AND " + condition.expr)
+		queryArgs = append(queryArgs, condition.args...)
+	}
+
+	rows, err := dbs.db.QueryContext(ctx, query.String()+" ORDER BY fts_rank", queryArgs...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dbRows{rows: rows, snippet: true}, nil
+}
+
+// ftsQuery quotes words so that characters like # or - are not interpreted
+// as fts5 syntax, matching words as prefixes.
+func ftsQuery(words []string) string {
+	quoted := make([]string, 0, len(words))
+	for _, word := range words {
+		quoted = append(quoted, `"`+strings.ReplaceAll(word, `"`, `""`)+`"*`)
+	}
+	return strings.Join(quoted, " ")
+}
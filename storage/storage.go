@@ -17,14 +17,29 @@ var ErrNotFound = fmt.Errorf("not found")
 type Storage interface {
 	Find(ctx context.Context, namespace string, id any) (*Row, error)
 	Query(ctx context.Context, namespace string, conditions ...Condition) (Rows, error)
+	Search(ctx context.Context, namespace string, terms string, conditions ...Condition) (Rows, error)
 	Insert(ctx context.Context, row *Row) error
 	Update(ctx context.Context, row *Row) error
+	UpdateAndInsert(ctx context.Context, row *Row, next *Row, field string) error
+	SetField(ctx context.Context, namespace string, kind string, id int64, name string, value any) error
+	Delete(ctx context.Context, namespace string, kind string, id int64) error
+	Restore(ctx context.Context, namespace string, kind string, id int64) error
+	Trash(ctx context.Context, namespace string) (Rows, error)
+	History(ctx context.Context, namespace string, kind string, id int64) ([]Revision, error)
+	Purge(ctx context.Context, deletedBefore time.Time) (int64, error)
+	Namespaces(ctx context.Context) ([]string, error)
+	TagCounts(ctx context.Context, namespace string) ([]TagCount, error)
+	CountCreated(ctx context.Context, namespace string, from time.Time, to time.Time) ([]DayCount, error)
+	Rates(ctx context.Context) ([]Rate, error)
+	SetRates(ctx context.Context, rates []Rate) error
 	Close() error
 }
 
 type Rows interface {
 	Next() bool
 	Scan(row *Row) error
+	// Err returns the error that stopped Next early, if any.
+	Err() error
 	Close() error
 }
 
@@ -34,6 +49,7 @@ type Metadata struct {
 	Tags         []string
 	DateCreated  time.Time
 	DateModified time.Time
+	DateDeleted  time.Time
 	ID           int64
 }
 
@@ -43,31 +59,57 @@ func NewDBStorage(ctx context.Context, dsn string) (Storage, error) {
 		return nil, err
 	}
 
-	_, err = db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS things (namespace TEXT, kind TEXT, tags TEXT, date_created INT, date_modified INT, id INT, value1 TEXT, value2 TEXT, value3 TEXT, value4 TEXT, value5 TEXT, value6 TEXT, value7 TEXT, value8 TEXT, value9 TEXT)")
+	fts, err := ftsAvailable(ctx, db)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS things_v2 (namespace TEXT NOT NULL, kind TEXT NOT NULL, id INTEGER NOT NULL, summary TEXT NOT NULL, content TEXT, ref TEXT, number INTEGER, float REAL, bool INTEGER, time INTEGER, fields_json BLOB, tags TEXT NOT NULL, date_created INTEGER NOT NULL, date_modified INTEGER NOT NULL, PRIMARY KEY (namespace, kind, id))")
+	if !fts {
+		err := checkFTSTriggers(ctx, db)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = migrate(ctx, db)
 	if err != nil {
 		return nil, err
 	}
 
-	return &dbStorage{db: db}, nil
+	if fts {
+		err := createFTS(ctx, db)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &dbStorage{db: db, fts: fts}, nil
 }
 
 type dbStorage struct {
 	db *sql.DB
+
+	// fts is true if sqlite was built with fts5, see [createFTS]
+	fts bool
 }
 
 type dbRows struct {
 	rows *sql.Rows
+
+	// snippet is true if the rows have an additional snippet column
+	snippet bool
+	// extra are scanned from additional columns after the row
+	extra []any
 }
 
 func (dbr *dbRows) Next() bool {
 	return dbr.rows.Next()
 }
 
+func (dbr *dbRows) Err() error {
+	return dbr.rows.Err()
+}
+
 func (dbr *dbRows) Close() error {
 	return dbr.rows.Close()
 }
@@ -79,7 +121,7 @@ func (dbs *dbStorage) Close() error {
 // v2 sketch
 
 func (dbs *dbStorage) Find(ctx context.Context, namespace string, id any) (*Row, error) {
-	query := "SELECT namespace, kind, id, summary, content, ref, number, float, bool, time, jsonb(fields_json), tags, date_created, date_modified FROM things_v2 WHERE namespace = ? and id = ?"
+	query := "SELECT " + selectColumns + " FROM things_v2 WHERE namespace = ? AND id = ? AND date_deleted IS NULL"
 	rows, err := dbs.db.QueryContext(ctx, query, namespace, id)
 	if err != nil {
 		return nil, err
@@ -100,6 +142,9 @@ func (dbs *dbStorage) Find(ctx context.Context, namespace string, id any) (*Row,
 	return &row, nil
 }
 
+// selectColumns are the columns scanned by [dbRows.Scan].
+const selectColumns = "namespace, kind, id, summary, content, ref, number, float, bool, time, json(fields_json), tags, date_created, date_modified, date_deleted"
+
 type Condition struct {
 	expr string
 	args []any
@@ -111,15 +156,50 @@ func (c Condition) Args() []any  { return c.args }
 func Kind(kind string) Condition       { return Condition{expr: "kind = ?", args: []any{kind}} }
 func Summary(summary string) Condition { return Condition{expr: "summary = ?", args: []any{summary}} }
 
+// Tag matches things tagged with tag or one of its children, e.g. #work
+// matches #work/clientA as well.
+func Tag(tag string) Condition {
+	return Condition{
+		expr: "EXISTS (SELECT 1 FROM things_tags WHERE things_tags.namespace = things_v2.namespace AND things_tags.kind = things_v2.kind AND things_tags.id = things_v2.id AND (things_tags.tag = ? OR substr(things_tags.tag, 1, length(?) + 1) = ? || '/'))",
+		args: []any{tag, tag, tag},
+	}
+}
+
+func Eq(field string, val any) Condition { return Condition{expr: field + " = ?", args: []any{val}} }
 func Gt(field string, val any) Condition { return Condition{expr: field + " > ?", args: []any{val}} }
+func Ge(field string, val any) Condition { return Condition{expr: field + " >= ?", args: []any{val}} }
 func Lt(field string, val any) Condition { return Condition{expr: field + " < ?", args: []any{val}} }
+func Le(field string, val any) Condition { return Condition{expr: field + " <= ?", args: []any{val}} }
 func Match(field string, val string) Condition {
-	return Condition{expr: field + " LIKE concat('%', ?, '%')", args: []any{val}}
+	return Condition{expr: field + ` LIKE concat('%', ?, '%') ESCAPE '\'`, args: []any{likeEscaper.Replace(val)}}
+}
+func Is(field string, val any) Condition { return Condition{expr: field + " IS ?", args: []any{val}} }
+func Not(c Condition) Condition          { return Condition{expr: "NOT (" + c.expr + ")", args: c.args} }
+
+// likeEscaper escapes the wildcards of LIKE in [Match], so that `100%` only
+// matches itself.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// Or matches things that match any of conditions.
+func Or(conditions ...Condition) Condition {
+	exprs := make([]string, len(conditions))
+	args := make([]any, 0, len(conditions))
+	for i, c := range conditions {
+		exprs[i] = c.expr
+		args = append(args, c.args...)
+	}
+	return Condition{expr: "(" + strings.Join(exprs, " OR ") + ")", args: args}
+}
+
+// Field matches things with val in Fields[name].  Unlike with Eq, things
+// without the field are matched by Not(Field(...)).
+func Field(name string, val any) Condition {
+	return Condition{expr: "json_extract(fields_json, ?) IS ?", args: []any{"$." + name, val}}
 }
 
 func (dbs *dbStorage) Query(ctx context.Context, namespace string, conditions ...Condition) (Rows, error) {
 	var query strings.Builder
-	query.WriteString("SELECT namespace, kind, id, summary, content, ref, number, float, bool, time, jsonb(fields_json), tags, date_created, date_modified FROM things_v2 WHERE namespace = ?")
+	query.WriteString("SELECT " + selectColumns + " FROM things_v2 WHERE namespace = ? AND date_deleted IS NULL")
 	queryArgs := []any{namespace}
 
 	for _, condition := range conditions {
@@ -139,6 +219,21 @@ func (dbs *dbStorage) Query(ctx context.Context, namespace string, conditions ..
 }
 
 func (dbs *dbStorage) Insert(ctx context.Context, row *Row) error {
+	tx, err := dbs.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insert(ctx, tx, row)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insert(ctx context.Context, tx *sql.Tx, row *Row) error {
 	if row.Namespace == "" {
 		return fmt.Errorf("namespace cannot be empty")
 	}
@@ -149,16 +244,9 @@ func (dbs *dbStorage) Insert(ctx context.Context, row *Row) error {
 		return fmt.Errorf("summary cannot be empty")
 	}
 
-	row.ID = time.Now().Unix()
 	row.DateCreated = time.Now().UTC().Truncate(time.Second)
 
-	tags := row.Tags
-	tags = append(tags, tagsFromString(row.Summary)...)
-	if row.Content.Valid {
-		tags = append(tags, tagsFromString(row.Content.String)...)
-	}
-	slices.Sort(tags)
-	tags = slices.Compact(tags)
+	tags := rowTags(row)
 
 	var timeValue sql.NullInt64 // convert time to int64 because otherwise sqlite stores a string
 	if row.Time.Valid {
@@ -175,28 +263,130 @@ func (dbs *dbStorage) Insert(ctx context.Context, row *Row) error {
 		}
 	}
 
-	res, err := dbs.db.ExecContext(ctx, `INSERT INTO things_v2 (namespace, kind, id, summary, content, ref, number, float, bool, time, fields_json, tags, date_created, date_modified) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		row.Namespace, row.Kind, row.ID, row.Summary,
+	// ids are unix timestamps, bumped past the largest id in the namespace so
+	// that things saved in the same second do not collide.  this happens in
+	// one statement so that concurrent inserts cannot get the same id.
+	err := tx.QueryRowContext(ctx, `INSERT INTO things_v2 (namespace, kind, id, summary, content, ref, number, float, bool, time, fields_json, tags, date_created, date_modified)
+		SELECT ?, ?, max(?, coalesce(max(id), 0) + 1), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ? FROM things_v2 WHERE namespace = ?
+		RETURNING id`,
+		row.Namespace, row.Kind, row.DateCreated.Unix(), row.Summary,
 		row.Content, row.Ref, row.Number, row.Float, row.Bool, timeValue, fieldsJSON,
 		strings.Join(tags, ","), row.DateCreated.Unix(), row.DateModified.Unix(),
-	)
+		row.Namespace,
+	).Scan(&row.ID)
 	if err != nil {
 		return err
 	}
 
-	n, err := res.RowsAffected()
+	err = setTags(ctx, tx, row.Namespace, row.Kind, row.ID, tags)
 	if err != nil {
 		return err
 	}
 
-	if n != 1 {
-		return fmt.Errorf("expected %d changes, but %d changes happened", 1, n)
+	return setLinks(ctx, tx, row)
+}
+
+func (dbs *dbStorage) Update(ctx context.Context, row *Row) error {
+	tx, err := dbs.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback()
 
-	return nil
+	err = update(ctx, tx, row)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (dbs *dbStorage) Update(ctx context.Context, row *Row) error {
+// UpdateAndInsert updates row and inserts next in one transaction, recording
+// the id of next in row.Fields[field].  If the thing has that field already,
+// e.g. because it was updated concurrently, only row is updated.
+func (dbs *dbStorage) UpdateAndInsert(ctx context.Context, row *Row, next *Row, field string) error {
+	tx, err := dbs.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var inserted sql.NullInt64
+	err = tx.QueryRowContext(ctx, "SELECT json_extract(fields_json, ?) FROM things_v2 WHERE namespace = ? AND kind = ? AND id = ? AND date_deleted IS NULL",
+		"$."+field, row.Namespace, row.Kind, row.ID).Scan(&inserted)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if row.Fields == nil {
+		row.Fields = make(map[string]any, 1)
+	}
+
+	if inserted.Valid {
+		row.Fields[field] = inserted.Int64
+	} else {
+		err := insert(ctx, tx, next)
+		if err != nil {
+			return err
+		}
+		row.Fields[field] = next.ID
+	}
+
+	err = update(ctx, tx, row)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetField sets one field of a thing, without recording a revision or
+// changing when it was modified, e.g. to archive it.
+func (dbs *dbStorage) SetField(ctx context.Context, namespace string, kind string, id int64, name string, value any) error {
+	tx, err := dbs.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var fieldsJSON sql.NullString
+	err = tx.QueryRowContext(ctx, "SELECT json(fields_json) FROM things_v2 WHERE namespace = ? AND kind = ? AND id = ? AND date_deleted IS NULL",
+		namespace, kind, id).Scan(&fieldsJSON)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	fields := make(map[string]any, 1)
+	if fieldsJSON.Valid {
+		err := json.Unmarshal([]byte(fieldsJSON.String), &fields)
+		if err != nil {
+			return fmt.Errorf("invalid 'fields': %w", err)
+		}
+	}
+	fields[name] = value
+
+	// marshaled like in [dbStorage.Update], so that revisions compare equal
+	marshaled, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE things_v2 SET fields_json = ? WHERE namespace = ? AND kind = ? AND id = ?",
+		marshaled, namespace, kind, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func update(ctx context.Context, tx *sql.Tx, row *Row) error {
 	if row.Namespace == "" || row.Kind == "" {
 		return fmt.Errorf("namespace and kind must be set")
 	}
@@ -211,18 +401,46 @@ func (dbs *dbStorage) Update(ctx context.Context, row *Row) error {
 	query += ", summary = ?"
 	queryArgs = append(queryArgs, row.Summary)
 
-	query += ", content = ?"
-	queryArgs = append(queryArgs, row.Content)
+	query += ", content = ?, ref = ?, number = ?, float = ?"
+	queryArgs = append(queryArgs, row.Content, row.Ref, row.Number, row.Float)
+
+	var timeValue sql.NullInt64
+	if row.Time.Valid {
+		timeValue.Int64 = row.Time.Time.UTC().Truncate(time.Second).Unix()
+		timeValue.Valid = true
+	}
+	query += ", time = ?"
+	queryArgs = append(queryArgs, timeValue)
+
+	var fieldsJSON []byte
+	if row.Fields != nil {
+		var err error
+		fieldsJSON, err = json.Marshal(row.Fields)
+		if err != nil {
+			return err
+		}
+	}
+	query += ", fields_json = ?"
+	queryArgs = append(queryArgs, fieldsJSON)
+
+	tags := rowTags(row)
+	query += ", tags = ?"
+	queryArgs = append(queryArgs, strings.Join(tags, ","))
 
 	if row.Bool.Valid {
 		query += ", bool = ?"
 		queryArgs = append(queryArgs, row.Bool)
 	}
 
-	query += " WHERE namespace = ? AND kind = ? AND id = ?"
+	query += " WHERE namespace = ? AND kind = ? AND id = ? AND date_deleted IS NULL"
 	queryArgs = append(queryArgs, row.Namespace, row.Kind, row.ID)
 
-	res, err := dbs.db.ExecContext(ctx, query, queryArgs...)
+	err := recordRevision(ctx, tx, row, timeValue, fieldsJSON)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx, query, queryArgs...)
 	if err != nil {
 		return err
 	}
@@ -236,7 +454,47 @@ func (dbs *dbStorage) Update(ctx context.Context, row *Row) error {
 		return fmt.Errorf("expected %d changes, but %d changes happened", 1, n)
 	}
 
-	return nil
+	err = setTags(ctx, tx, row.Namespace, row.Kind, row.ID, tags)
+	if err != nil {
+		return err
+	}
+
+	return setLinks(ctx, tx, row)
+}
+
+func (dbs *dbStorage) Namespaces(ctx context.Context) ([]string, error) {
+	rows, err := dbs.db.QueryContext(ctx, "SELECT DISTINCT namespace FROM things_v2 ORDER BY namespace")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	namespaces := make([]string, 0, 1)
+	for rows.Next() {
+		var namespace string
+		err := rows.Scan(&namespace)
+		if err != nil {
+			return nil, err
+		}
+		namespaces = append(namespaces, namespace)
+	}
+
+	return namespaces, rows.Err()
+}
+
+// rowTags returns the tags of row, including the ones mentioned in the summary
+// and content.
+func rowTags(row *Row) []string {
+	tags := row.Tags
+	tags = append(tags, tagsFromString(row.Summary)...)
+	if row.Content.Valid {
+		tags = append(tags, tagsFromString(row.Content.String)...)
+	}
+	if slices.Contains(tags, "") {
+		tags = slices.DeleteFunc(tags, func(tag string) bool { return tag == "" })
+	}
+	slices.Sort(tags)
+	return slices.Compact(tags)
 }
 
 func tagsFromString(s string) []string {
@@ -265,21 +523,34 @@ type Row struct {
 	Time    sql.NullTime
 
 	Fields map[string]any
+
+	// Snippet is the highlighted match for rows returned by Search, with
+	// matches enclosed in SnippetStart and SnippetEnd.
+	Snippet string
 }
 
 func (dbr *dbRows) Scan(row *Row) error {
-	var fieldsRaw any
+	var fieldsJSON sql.NullString
 	var tags string
 	var dateCreated int64
 	var dateModified int64
+	var dateDeleted sql.NullInt64
 	var timeValue sql.NullInt64
-	err := dbr.rows.Scan(&row.Namespace, &row.Kind, &row.ID, &row.Summary, &row.Content, &row.Ref, &row.Number, &row.Float, &row.Bool, &timeValue, &fieldsRaw, &tags, &dateCreated, &dateModified)
+	dest := []any{&row.Namespace, &row.Kind, &row.ID, &row.Summary, &row.Content, &row.Ref, &row.Number, &row.Float, &row.Bool, &timeValue, &fieldsJSON, &tags, &dateCreated, &dateModified, &dateDeleted}
+	if dbr.snippet {
+		dest = append(dest, &row.Snippet)
+	}
+	dest = append(dest, dbr.extra...)
+	err := dbr.rows.Scan(dest...)
 	if err != nil {
 		return err
 	}
 
 	row.DateCreated = time.Unix(dateCreated, 0).UTC()
 	row.DateModified = time.Unix(dateModified, 0).UTC()
+	if dateDeleted.Valid {
+		row.DateDeleted = time.Unix(dateDeleted.Int64, 0).UTC()
+	}
 
 	if timeValue.Valid {
 		row.Time.Time = time.Unix(timeValue.Int64, 0).UTC()
@@ -287,12 +558,11 @@ func (dbr *dbRows) Scan(row *Row) error {
 	}
 
 	row.Tags = strings.Split(tags, ",")
-	if fieldsRaw != nil {
-		fields, ok := fieldsRaw.(map[string]any)
-		if !ok {
-			return fmt.Errorf("invalid 'fields': %#v", fields)
+	if fieldsJSON.Valid {
+		err := json.Unmarshal([]byte(fieldsJSON.String), &row.Fields)
+		if err != nil {
+			return fmt.Errorf("invalid 'fields': %w", err)
 		}
-		row.Fields = fields
 	}
 
 	return nil
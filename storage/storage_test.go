@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"database/sql"
 	"testing"
 	"time"
 
@@ -88,3 +89,373 @@ func TestInsert(t *testing.T) {
 
 	require.False(t, rows.Next())
 }
+
+func TestNamespacesAndNotIs(t *testing.T) {
+	st, err := NewDBStorage(context.Background(), ":memory:")
+	require.NoError(t, err)
+
+	for _, namespace := range []string{"b", "a"} {
+		err := st.Insert(context.Background(), &Row{
+			Metadata: Metadata{Namespace: namespace, Kind: "reminder"},
+			Summary:  "reminder in " + namespace,
+		})
+		require.NoError(t, err)
+	}
+
+	namespaces, err := st.Namespaces(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, namespaces)
+
+	rows, err := st.Query(context.Background(), "a", Not(Is("bool", true)))
+	require.NoError(t, err)
+	require.True(t, rows.Next())
+
+	var row Row
+	require.NoError(t, rows.Scan(&row))
+	require.NoError(t, rows.Close())
+
+	row.Bool.Bool = true
+	row.Bool.Valid = true
+	require.NoError(t, st.Update(context.Background(), &row))
+
+	rows, err = st.Query(context.Background(), "a", Not(Is("bool", true)))
+	require.NoError(t, err)
+	require.False(t, rows.Next())
+	require.NoError(t, rows.Close())
+}
+
+func TestSearch(t *testing.T) {
+	st, err := NewDBStorage(context.Background(), ":memory:")
+	require.NoError(t, err)
+
+	for _, row := range []Row{
+		{Metadata: Metadata{Namespace: "test", Kind: "note"}, Summary: "fix the bike #errands"},
+		{Metadata: Metadata{Namespace: "test", Kind: "task"}, Summary: "buy groceries"},
+		{Metadata: Metadata{Namespace: "other", Kind: "note"}, Summary: "bike ride"},
+	} {
+		err := st.Insert(context.Background(), &row)
+		require.NoError(t, err)
+	}
+
+	rows, err := st.Search(context.Background(), "test", "bike #errands")
+	require.NoError(t, err)
+	defer rows.Close()
+
+	require.True(t, rows.Next())
+	var row Row
+	require.NoError(t, rows.Scan(&row))
+	require.Equal(t, "fix the bike #errands", row.Summary)
+	if st.(*dbStorage).fts {
+		require.Contains(t, row.Snippet, SnippetStart+"bike"+SnippetEnd)
+	}
+
+	require.False(t, rows.Next())
+
+	if !st.(*dbStorage).fts {
+		// wildcards only match themselves without fts as well
+		for _, terms := range []string{"b_ke", "fix%bike"} {
+			rows, err := st.Search(context.Background(), "test", terms)
+			require.NoError(t, err)
+			require.False(t, rows.Next(), terms)
+			require.NoError(t, rows.Close())
+		}
+	}
+}
+
+func TestTags(t *testing.T) {
+	st, err := NewDBStorage(context.Background(), ":memory:")
+	require.NoError(t, err)
+
+	for _, row := range []Row{
+		{Metadata: Metadata{Namespace: "test", Kind: "note"}, Summary: "call them #work/clientA"},
+		{Metadata: Metadata{Namespace: "test", Kind: "task"}, Summary: "write report #work"},
+		{Metadata: Metadata{Namespace: "test", Kind: "later"}, Summary: "read a book #workshop"},
+	} {
+		err := st.Insert(context.Background(), &row)
+		require.NoError(t, err)
+	}
+
+	counts, err := st.TagCounts(context.Background(), "test")
+	require.NoError(t, err)
+	require.Equal(t, []TagCount{{"#work", 1}, {"#work/clientA", 1}, {"#workshop", 1}}, counts)
+
+	rows, err := st.Query(context.Background(), "test", Tag("#work"))
+	require.NoError(t, err)
+	defer rows.Close()
+
+	kinds := []string{}
+	for rows.Next() {
+		var row Row
+		require.NoError(t, rows.Scan(&row))
+		kinds = append(kinds, row.Kind)
+	}
+	require.ElementsMatch(t, []string{"note", "task"}, kinds)
+}
+
+func TestLinksAndMatch(t *testing.T) {
+	ctx := context.Background()
+	st, err := NewDBStorage(ctx, ":memory:")
+	require.NoError(t, err)
+
+	note := Row{Metadata: Metadata{Namespace: "test", Kind: "note"}, Summary: "see [[bike]]", Content: sql.NullString{String: "and [[ task/1 ]]", Valid: true}}
+	require.NoError(t, st.Insert(ctx, &note))
+	require.NoError(t, st.Insert(ctx, &Row{Metadata: Metadata{Namespace: "test", Kind: "note"}, Summary: "100% done_ish"}))
+
+	query := func(conditions ...Condition) []string {
+		rows, err := st.Query(ctx, "test", conditions...)
+		require.NoError(t, err)
+		defer rows.Close()
+
+		summaries := []string{}
+		for rows.Next() {
+			var row Row
+			require.NoError(t, rows.Scan(&row))
+			summaries = append(summaries, row.Summary)
+		}
+		return summaries
+	}
+
+	require.Equal(t, []string{"see [[bike]]"}, query(LinksTo("task/1")))
+	require.Equal(t, []string{"see [[bike]]"}, query(LinksTo("car", "bike")))
+	require.Empty(t, query(LinksTo("Bike")))
+
+	note.Summary = "see [[car]]"
+	require.NoError(t, st.Update(ctx, &note))
+	require.Empty(t, query(LinksTo("bike")))
+	require.Equal(t, []string{"see [[car]]"}, query(LinksTo("car")))
+
+	// wildcards only match themselves
+	require.Equal(t, []string{"100% done_ish"}, query(Match("summary", "0% done_")))
+	require.Empty(t, query(Match("summary", "1%done")))
+	require.Empty(t, query(Match("summary", "done ish")))
+}
+
+func TestDeleteRestorePurge(t *testing.T) {
+	ctx := context.Background()
+	st, err := NewDBStorage(ctx, ":memory:")
+	require.NoError(t, err)
+
+	row := Row{Metadata: Metadata{Namespace: "test", Kind: "note"}, Summary: "oops #typo [[typos]]"}
+	require.NoError(t, st.Insert(ctx, &row))
+
+	require.NoError(t, st.Delete(ctx, "test", "note", row.ID))
+	require.ErrorIs(t, st.Delete(ctx, "test", "note", row.ID), ErrNotFound)
+
+	_, err = st.Find(ctx, "test", row.ID)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	counts, err := st.TagCounts(ctx, "test")
+	require.NoError(t, err)
+	require.Empty(t, counts)
+
+	trash, err := st.Trash(ctx, "test")
+	require.NoError(t, err)
+	require.True(t, trash.Next())
+	var deleted Row
+	require.NoError(t, trash.Scan(&deleted))
+	require.NoError(t, trash.Close())
+	require.False(t, deleted.DateDeleted.IsZero())
+
+	require.NoError(t, st.Restore(ctx, "test", "note", row.ID))
+	found, err := st.Find(ctx, "test", row.ID)
+	require.NoError(t, err)
+	require.True(t, found.DateDeleted.IsZero())
+
+	counts, err = st.TagCounts(ctx, "test")
+	require.NoError(t, err)
+	require.Equal(t, []TagCount{{"#typo", 1}}, counts)
+
+	require.NoError(t, st.Delete(ctx, "test", "note", row.ID))
+	n, err := st.Purge(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+	require.ErrorIs(t, st.Restore(ctx, "test", "note", row.ID), ErrNotFound)
+
+	// nothing is left behind
+	for _, table := range []string{"things_history", "things_tags", "things_links"} {
+		var left int
+		require.NoError(t, st.(*dbStorage).db.QueryRow("SELECT count(*) FROM "+table).Scan(&left))
+		require.Zero(t, left, table)
+	}
+}
+
+func TestInsertSameSecond(t *testing.T) {
+	ctx := context.Background()
+	st, err := NewDBStorage(ctx, ":memory:")
+	require.NoError(t, err)
+
+	ids := make([]int64, 0, 10)
+	for i := 0; i < 10; i++ {
+		for _, kind := range []string{"note", "task"} {
+			row := Row{Metadata: Metadata{Namespace: "test", Kind: kind}, Summary: "bulk import"}
+			require.NoError(t, st.Insert(ctx, &row))
+			ids = append(ids, row.ID)
+		}
+	}
+
+	for i := 1; i < len(ids); i++ {
+		require.Greater(t, ids[i], ids[i-1])
+	}
+	require.GreaterOrEqual(t, ids[0], time.Now().Add(-time.Minute).Unix())
+}
+
+func TestFields(t *testing.T) {
+	ctx := context.Background()
+	st, err := NewDBStorage(ctx, ":memory:")
+	require.NoError(t, err)
+
+	row := Row{Metadata: Metadata{Namespace: "test", Kind: "track"}, Summary: "coffee", Fields: map[string]any{"unit": "cups"}}
+	require.NoError(t, st.Insert(ctx, &row))
+
+	found, err := st.Find(ctx, "test", row.ID)
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{"unit": "cups"}, found.Fields)
+}
+
+func TestUpdateTimeAndFields(t *testing.T) {
+	ctx := context.Background()
+	st, err := NewDBStorage(ctx, ":memory:")
+	require.NoError(t, err)
+
+	row := Row{Metadata: Metadata{Namespace: "test", Kind: "reminder"}, Summary: "call bank"}
+	require.NoError(t, st.Insert(ctx, &row))
+
+	row.Time.Time = ourEpoch
+	row.Time.Valid = true
+	row.Fields = map[string]any{"state": "dismissed"}
+	require.NoError(t, st.Update(ctx, &row))
+
+	found, err := st.Find(ctx, "test", row.ID)
+	require.NoError(t, err)
+	require.True(t, found.Time.Time.Equal(ourEpoch))
+	require.Equal(t, map[string]any{"state": "dismissed"}, found.Fields)
+
+	rows, err := st.Query(ctx, "test", Field("state", "dismissed"))
+	require.NoError(t, err)
+	require.True(t, rows.Next())
+	require.NoError(t, rows.Close())
+
+	rows, err = st.Query(ctx, "test", Field("state", "pending"))
+	require.NoError(t, err)
+	require.False(t, rows.Next())
+	require.NoError(t, rows.Close())
+
+	// things without the field are not archived
+	rows, err = st.Query(ctx, "test", Not(Field("archived", true)))
+	require.NoError(t, err)
+	require.True(t, rows.Next())
+	require.NoError(t, rows.Close())
+
+	rows, err = st.Query(ctx, "test", Or(Field("state", "pending"), Match("summary", "bank")))
+	require.NoError(t, err)
+	require.True(t, rows.Next())
+	require.NoError(t, rows.Close())
+}
+
+func TestHistory(t *testing.T) {
+	ctx := context.Background()
+	st, err := NewDBStorage(ctx, ":memory:")
+	require.NoError(t, err)
+
+	row := Row{Metadata: Metadata{Namespace: "test", Kind: "note"}, Summary: "first", Fields: map[string]any{"pinned": true}}
+	require.NoError(t, st.Insert(ctx, &row))
+
+	for _, summary := range []string{"second", "third"} {
+		row.Summary = summary
+		require.NoError(t, st.Update(ctx, &row))
+	}
+
+	revisions, err := st.History(ctx, "test", "note", row.ID)
+	require.NoError(t, err)
+	require.Len(t, revisions, 2)
+	require.Equal(t, int64(2), revisions[0].Revision)
+	require.Equal(t, "second", revisions[0].Summary)
+	require.Equal(t, int64(1), revisions[1].Revision)
+	require.Equal(t, "first", revisions[1].Summary)
+
+	// only marking it as done is not a revision
+	row.Bool = sql.NullBool{Bool: true, Valid: true}
+	require.NoError(t, st.Update(ctx, &row))
+	revisions, err = st.History(ctx, "test", "note", row.ID)
+	require.NoError(t, err)
+	require.Len(t, revisions, 2)
+
+	// but changing its number or time is
+	row.Number = sql.NullInt64{Int64: 3, Valid: true}
+	require.NoError(t, st.Update(ctx, &row))
+	row.Time = sql.NullTime{Time: time.Now(), Valid: true}
+	require.NoError(t, st.Update(ctx, &row))
+	revisions, err = st.History(ctx, "test", "note", row.ID)
+	require.NoError(t, err)
+	require.Len(t, revisions, 4)
+	require.Equal(t, int64(3), revisions[0].Number.Int64)
+	require.False(t, revisions[0].Time.Valid)
+}
+
+func TestRates(t *testing.T) {
+	ctx := context.Background()
+	st, err := NewDBStorage(ctx, ":memory:")
+	require.NoError(t, err)
+
+	day := func(d int) time.Time { return time.Date(2024, 8, d, 0, 0, 0, 0, time.UTC) }
+
+	err = st.SetRates(ctx, []Rate{
+		{Base: "eur", Quote: "usd", Rate: 1.1, Date: day(15)},
+		{Base: "eur", Quote: "jpy", Rate: 160, Date: day(15)},
+	})
+	require.NoError(t, err)
+
+	// older rates do not replace newer ones
+	err = st.SetRates(ctx, []Rate{
+		{Base: "eur", Quote: "usd", Rate: 1.2, Date: day(16)},
+		{Base: "eur", Quote: "jpy", Rate: 150, Date: day(14)},
+	})
+	require.NoError(t, err)
+
+	rates, err := st.Rates(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []Rate{
+		{Base: "eur", Quote: "jpy", Rate: 160, Date: day(15)},
+		{Base: "eur", Quote: "usd", Rate: 1.2, Date: day(16)},
+	}, rates)
+}
+
+func TestCountCreated(t *testing.T) {
+	ctx := context.Background()
+	st, err := NewDBStorage(ctx, ":memory:")
+	require.NoError(t, err)
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	// summer time ends on 2024-10-27 at 3:00
+	for i, thing := range []struct {
+		kind    string
+		created time.Time
+	}{
+		{"note", time.Date(2024, 10, 1, 0, 30, 0, 0, berlin)},
+		{"note", time.Date(2024, 10, 27, 0, 30, 0, 0, berlin)},
+		{"task", time.Date(2024, 10, 27, 23, 30, 0, 0, berlin)},
+		{"note", time.Date(2024, 10, 28, 0, 30, 0, 0, berlin)},
+		{"note", time.Date(2024, 11, 1, 0, 30, 0, 0, berlin)},
+	} {
+		_, err := st.(*dbStorage).db.Exec("INSERT INTO things_v2 (namespace, kind, id, summary, tags, date_created, date_modified) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			"test", thing.kind, i+1, "thing", "", thing.created.Unix(), thing.created.Unix())
+		require.NoError(t, err)
+	}
+
+	from := time.Date(2024, 10, 1, 0, 0, 0, 0, berlin)
+	counts, err := st.CountCreated(ctx, "test", from, from.AddDate(0, 1, 0))
+	require.NoError(t, err)
+	require.Equal(t, []DayCount{
+		{Date: "2024-10-01", Kind: "note", Count: 1},
+		{Date: "2024-10-27", Kind: "note", Count: 1},
+		{Date: "2024-10-27", Kind: "task", Count: 1},
+		{Date: "2024-10-28", Kind: "note", Count: 1},
+	}, counts)
+
+	from = time.Date(2024, 9, 30, 0, 0, 0, 0, time.UTC)
+	counts, err = st.CountCreated(ctx, "test", from, from.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	require.Equal(t, []DayCount{{Date: "2024-09-30", Kind: "note", Count: 1}}, counts)
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// createTags creates the things_tags table, with one row per tag of each
+// thing, filling it from things_v2.
+func createTags(ctx context.Context, tx *sql.Tx) error {
+	var exists bool
+	err := tx.QueryRowContext(ctx, "SELECT count(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'things_tags'").Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, "CREATE TABLE things_tags (namespace TEXT NOT NULL, kind TEXT NOT NULL, id INTEGER NOT NULL, tag TEXT NOT NULL, PRIMARY KEY (namespace, tag, kind, id))")
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "CREATE INDEX things_tags_thing ON things_tags (namespace, kind, id)")
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT namespace, kind, id, tags FROM things_v2 WHERE date_deleted IS NULL")
+	if err != nil {
+		return err
+	}
+
+	type thingTags struct {
+		namespace, kind string
+		id              int64
+		tags            string
+	}
+	all := make([]thingTags, 0, 10)
+	for rows.Next() {
+		var tt thingTags
+		err := rows.Scan(&tt.namespace, &tt.kind, &tt.id, &tt.tags)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		all = append(all, tt)
+	}
+	err = rows.Close()
+	if err != nil {
+		return err
+	}
+
+	for _, tt := range all {
+		if tt.tags == "" {
+			continue
+		}
+
+		err := setTags(ctx, tx, tt.namespace, tt.kind, tt.id, strings.Split(tt.tags, ","))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setTags replaces the tags of a thing in things_tags.
+func setTags(ctx context.Context, tx *sql.Tx, namespace string, kind string, id int64, tags []string) error {
+	_, err := tx.ExecContext(ctx, "DELETE FROM things_tags WHERE namespace = ? AND kind = ? AND id = ?", namespace, kind, id)
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		if tag == "" {
+			continue
+		}
+
+		_, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO things_tags (namespace, kind, id, tag) VALUES (?, ?, ?, ?)", namespace, kind, id, tag)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type TagCount struct {
+	Tag   string
+	Count int
+}
+
+// TagCounts returns all tags in namespace with the number of things tagged
+// with them, sorted by tag.
+func (dbs *dbStorage) TagCounts(ctx context.Context, namespace string) ([]TagCount, error) {
+	rows, err := dbs.db.QueryContext(ctx, "SELECT tag, count(*) FROM things_tags WHERE namespace = ? GROUP BY tag ORDER BY tag", namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make([]TagCount, 0, 10)
+	for rows.Next() {
+		var count TagCount
+		err := rows.Scan(&count.Tag, &count.Count)
+		if err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+
+	return counts, rows.Err()
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Delete moves a thing to the trash, from where it can be restored until it
+// is purged.
+func (dbs *dbStorage) Delete(ctx context.Context, namespace string, kind string, id int64) error {
+	tx, err := dbs.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "UPDATE things_v2 SET date_deleted = ? WHERE namespace = ? AND kind = ? AND id = ? AND date_deleted IS NULL",
+		time.Now().UTC().Unix(), namespace, kind, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n != 1 {
+		return ErrNotFound
+	}
+
+	err = setTags(ctx, tx, namespace, kind, id, nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Restore moves a thing out of the trash again.
+func (dbs *dbStorage) Restore(ctx context.Context, namespace string, kind string, id int64) error {
+	tx, err := dbs.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var tags string
+	err = tx.QueryRowContext(ctx, "UPDATE things_v2 SET date_deleted = NULL WHERE namespace = ? AND kind = ? AND id = ? AND date_deleted IS NOT NULL RETURNING tags",
+		namespace, kind, id).Scan(&tags)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	err = setTags(ctx, tx, namespace, kind, id, strings.Split(tags, ","))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Trash returns the deleted things in namespace, most recently deleted first.
+func (dbs *dbStorage) Trash(ctx context.Context, namespace string) (Rows, error) {
+	rows, err := dbs.db.QueryContext(ctx, "SELECT "+selectColumns+" FROM things_v2 WHERE namespace = ? AND date_deleted IS NOT NULL ORDER BY date_deleted DESC", namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dbRows{rows: rows}, nil
+}
+
+// Purge removes things that were deleted before deletedBefore for good,
+// returning how many were removed.
+func (dbs *dbStorage) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	tx, err := dbs.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM things_v2 WHERE date_deleted < ?", deletedBefore.UTC().Unix())
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if n == 0 {
+		return 0, nil
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM things_history WHERE NOT EXISTS (SELECT 1 FROM things_v2 WHERE things_v2.namespace = things_history.namespace AND things_v2.kind = things_history.kind AND things_v2.id = things_history.id)")
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM things_tags WHERE NOT EXISTS (SELECT 1 FROM things_v2 WHERE things_v2.namespace = things_tags.namespace AND things_v2.kind = things_tags.kind AND things_v2.id = things_tags.id)")
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM things_links WHERE NOT EXISTS (SELECT 1 FROM things_v2 WHERE things_v2.namespace = things_links.namespace AND things_v2.kind = things_links.kind AND things_v2.id = things_links.id)")
+	if err != nil {
+		return 0, err
+	}
+
+	return n, tx.Commit()
+}
@@ -11,20 +11,33 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"os"
 	"slices"
 	"strconv"
 	"strings"
 	"time"
+	_ "time/tzdata" // for the timezone setting, the docker image has no tzdata
 
 	"github.com/go-chi/chi/v5"
 
 	"github.com/heyLu/lp/go/things/handler"
+	"github.com/heyLu/lp/go/things/notify"
 	"github.com/heyLu/lp/go/things/storage"
 )
 
 var settings struct {
 	Addr   string
 	DBPath string
+
+	ReminderInterval time.Duration
+	NotifyWebhook    string
+	NotifyCommand    string
+
+	TrashDays int
+
+	BookmarkSnapshots bool
+	MathQalc          bool
+	ImportRates       string
 }
 
 //go:embed static
@@ -33,6 +46,13 @@ var staticFS embed.FS
 func main() {
 	flag.StringVar(&settings.Addr, "addr", "localhost:5000", "Address to listen on")
 	flag.StringVar(&settings.DBPath, "db-path", "things.db", "Path to db file")
+	flag.DurationVar(&settings.ReminderInterval, "reminder-interval", 30*time.Second, "How often to check for due reminders")
+	flag.StringVar(&settings.NotifyWebhook, "notify-webhook", "", "URL to POST due reminders to")
+	flag.StringVar(&settings.NotifyCommand, "notify-command", "", "Command to run for due reminders, with the summary as last argument")
+	flag.IntVar(&settings.TrashDays, "trash-days", 30, "Days to keep deleted things in the trash, 0 to keep them forever")
+	flag.BoolVar(&settings.BookmarkSnapshots, "bookmark-snapshots", false, "Store the text of bookmarked pages")
+	flag.BoolVar(&settings.MathQalc, "math-qalc", false, "Use qalc for math instead of the builtin calculator")
+	flag.StringVar(&settings.ImportRates, "import-rates", "", "Import exchange rates from an ECB XML or CSV file, e.g. eurofxref.xml")
 	flag.Parse()
 
 	dbStorage, err := storage.NewDBStorage(context.Background(), "file:"+settings.DBPath)
@@ -41,11 +61,47 @@ func main() {
 	}
 	defer dbStorage.Close()
 
+	if settings.ImportRates != "" {
+		err := importRates(context.Background(), dbStorage, settings.ImportRates)
+		if err != nil {
+			log.Fatalf("import rates: %s", err)
+		}
+	}
+
+	notifiers := notify.Notifiers{notify.LogNotifier{}}
+	if settings.NotifyWebhook != "" {
+		notifiers = append(notifiers, &notify.WebhookNotifier{URL: settings.NotifyWebhook})
+	}
+	if settings.NotifyCommand != "" {
+		notifiers = append(notifiers, notify.CommandNotifier(settings.NotifyCommand))
+	}
+
+	scheduler := &Scheduler{
+		storage:  dbStorage,
+		notifier: notifiers,
+		interval: settings.ReminderInterval,
+
+		trashRetention: time.Duration(settings.TrashDays) * 24 * time.Hour,
+	}
+	go scheduler.Run(context.Background())
+
 	things := &Things{
 		handlers: handler.All,
 		storage:  dbStorage,
 	}
 
+	if settings.BookmarkSnapshots || settings.MathQalc {
+		things.handlers = slices.Clone(things.handlers)
+		for i, h := range things.handlers {
+			switch h.(type) {
+			case handler.BookmarkHandler:
+				things.handlers[i] = handler.BookmarkHandler{Snapshot: settings.BookmarkSnapshots}
+			case handler.MathHandler:
+				things.handlers[i] = handler.MathHandler{Qalc: settings.MathQalc}
+			}
+		}
+	}
+
 	things.kinds = make(map[string]bool, len(things.handlers))
 	for _, h := range things.handlers {
 		kind, _ := h.CanHandle("")
@@ -59,9 +115,11 @@ func main() {
 
 	namespaceMiddleware := NamespaceMiddleware{router: router, kinds: things.kinds}
 	tokenMiddleware := tokenMiddleware{dbStorage}
+	settingsMiddleware := settingsMiddleware{dbStorage}
 	router.Use(
 		namespaceMiddleware.Middleware,
 		tokenMiddleware.Middleware,
+		settingsMiddleware.Middleware,
 	)
 
 	router.Get("/", things.HandleList)
@@ -71,16 +129,26 @@ func main() {
 
 	router.Post("/namespace", things.HandleSetNamespace)
 
+	router.Route("/api/v1/{namespace}", things.APIRoutes)
+
 	router.Route("/{namespace}", func(namespaceRouter chi.Router) {
 		namespaceRouter.Use(namespaceMiddleware.Middleware)
 
 		namespaceRouter.Get("/thing", things.HandleThing)
 		namespaceRouter.Post("/thing", things.HandleThing)
 
+		namespaceRouter.Get("/tag", things.HandleTag)
+		namespaceRouter.Get("/tag/*", things.HandleTag)
+
 		namespaceRouter.Get("/{kind}", things.HandleList)
 
 		namespaceRouter.Get("/{kind}/{id}", things.HandleFind)
 		namespaceRouter.Post("/{kind}/{id}", things.HandleEdit)
+		namespaceRouter.Delete("/{kind}/{id}", things.HandleDelete)
+		namespaceRouter.Post("/{kind}/{id}/delete", things.HandleDelete)
+		namespaceRouter.Post("/{kind}/{id}/restore", things.HandleRestore)
+		namespaceRouter.Get("/{kind}/{id}/history", things.HandleHistory)
+		namespaceRouter.Post("/{kind}/{id}/history/{revision}/restore", things.HandleRestoreRevision)
 	})
 
 	router.Get("/{kind}", func(w http.ResponseWriter, req *http.Request) {
@@ -221,11 +289,16 @@ func (t *Things) HandleThing(w http.ResponseWriter, req *http.Request) {
 
 	tellMe := req.Form.Get("tell-me")
 
-	ctx, cancel := context.WithTimeout(req.Context(), 1*time.Second)
-	defer cancel()
-
 	save := req.Method == http.MethodPost
 
+	// saving might fetch things, e.g. the title of a bookmark
+	timeout := 1 * time.Second
+	if save {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	defer cancel()
+
 	handled := false
 	for _, handler := range t.handlers {
 		err := t.handle(ctx, handler, t.storage, w, tellMe, save)
@@ -255,7 +328,7 @@ func (t *Things) handle(ctx context.Context, hndl handler.Handler, storage stora
 
 	fmt.Fprintln(w, kind)
 
-	thing, err := hndl.Parse(input)
+	thing, err := hndl.Parse(ctx, input)
 	if err != nil {
 		return err
 	}
@@ -264,7 +337,12 @@ func (t *Things) handle(ctx context.Context, hndl handler.Handler, storage stora
 	row.Namespace = ctx.Value(NamespaceKey).(string)
 
 	if save {
-		err := storage.Insert(ctx, row)
+		err := handler.BeforeSave(ctx, storage, hndl, row)
+		if err != nil {
+			return err
+		}
+
+		err = storage.Insert(ctx, row)
 		if err != nil {
 			return err
 		}
@@ -297,6 +375,28 @@ func (t *Things) handle(ctx context.Context, hndl handler.Handler, storage stora
 	return renderer.Render(ctx, w)
 }
 
+// evaluate parses input with the first handler that can handle it, without
+// saving or rendering anything.
+func (t *Things) evaluate(ctx context.Context, input string) (handler.Handler, *storage.Row, error) {
+	for _, hndl := range t.handlers {
+		_, ok := hndl.CanHandle(input)
+		if !ok {
+			continue
+		}
+
+		thing, err := hndl.Parse(ctx, input)
+		if err != nil {
+			return hndl, nil, err
+		}
+
+		row := thing.ToRow()
+		row.Namespace = ctx.Value(NamespaceKey).(string)
+		return hndl, row, nil
+	}
+
+	return nil, nil, ErrNotHandled
+}
+
 func (t *Things) HandleList(w http.ResponseWriter, req *http.Request) {
 	namespace := req.Context().Value(NamespaceKey).(string)
 	kindParam := chi.URLParam(req, "kind")
@@ -318,33 +418,72 @@ func (t *Things) HandleList(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// prefilled, e.g. to create the note a broken link points to
+	if tellMe := req.URL.Query().Get("tell-me"); tellMe != "" {
+		input = tellMe
+	}
+
 	pageWithContent(w, req, input, renderer)
 }
 
 func (t *Things) renderList(ctx context.Context, hndl handler.Handler, namespace string, input string) (handler.Renderer, error) {
+	// e.g. the stats of a track category, above its list
+	summary, err := handler.Summarize(ctx, t.storage, hndl, namespace, input)
+	if err != nil {
+		return nil, err
+	}
+
 	rows, err := hndl.Query(ctx, t.storage, namespace, input)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var prevDate *time.Time
-
-	res := []handler.Renderer{}
+	listed := make([]*storage.Row, 0, 10)
 	for rows.Next() {
 		var row storage.Row
 		err := rows.Scan(&row)
 		if err != nil {
 			return nil, err
 		}
+		listed = append(listed, &row)
+	}
 
+	// e.g. the subtasks of all tasks at once
+	listed, err = handler.Load(ctx, t.storage, hndl, listed...)
+	if err != nil {
+		return nil, err
+	}
+
+	// and the [[links]] of all of them
+	err = handler.LoadLinks(ctx, listed...)
+	if err != nil {
+		return nil, err
+	}
+
+	var prevDate *time.Time
+
+	// things are grouped by the day they were created, unless the handler
+	// knows better
+	grouper, _ := hndl.(handler.Grouper)
+	prevGroup := ""
+	loc := handler.Location(ctx)
+
+	res := []handler.Renderer{}
+	for _, row := range listed {
 		seq := make([]handler.Renderer, 0, 2)
-		if prevDate == nil || prevDate.Format(time.DateOnly) != row.DateCreated.Format(time.DateOnly) {
-			seq = append(seq, handler.HTMLRenderer(fmt.Sprintf(`<span class="timeline">%s</span>`, row.DateCreated.Format(time.DateOnly))))
-			prevDate = &row.DateCreated
+		if grouper != nil {
+			group := grouper.Group(ctx, row)
+			if group != prevGroup {
+				seq = append(seq, handler.HTMLRenderer(fmt.Sprintf(`<span class="timeline">%s</span>`, html.EscapeString(group))))
+				prevGroup = group
+			}
+		} else if created := row.DateCreated.In(loc); !row.DateCreated.IsZero() && (prevDate == nil || prevDate.Format(time.DateOnly) != created.Format(time.DateOnly)) {
+			seq = append(seq, handler.HTMLRenderer(fmt.Sprintf(`<span class="timeline">%s</span>`, created.Format(time.DateOnly))))
+			prevDate = &created
 		}
 
-		renderer, err := hndl.Render(ctx, &row)
+		renderer, err := hndl.Render(ctx, row)
 		if err != nil {
 			return nil, err
 		}
@@ -353,9 +492,33 @@ func (t *Things) renderList(ctx context.Context, hndl handler.Handler, namespace
 		res = append(res, handler.SequenceRenderer(seq))
 	}
 
+	if summary != nil {
+		return handler.SequenceRenderer{summary, handler.ListRenderer(res)}, nil
+	}
+
 	return handler.ListRenderer(res), nil
 }
 
+// HandleTag lists all things tagged with the tag in the path, or all tags if
+// there is none.
+func (t *Things) HandleTag(w http.ResponseWriter, req *http.Request) {
+	namespace := req.Context().Value(NamespaceKey).(string)
+
+	input := "tags"
+	if tag := chi.URLParam(req, "*"); tag != "" {
+		input = "search tag:#" + tag
+	}
+
+	_, hndl := t.handlers.For(input)
+	renderer, err := t.renderList(req.Context(), hndl, namespace, input)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	pageWithContent(w, req, input, renderer)
+}
+
 func (t *Things) HandleEdit(w http.ResponseWriter, req *http.Request) {
 	err := req.ParseForm()
 	if err != nil {
@@ -369,18 +532,23 @@ func (t *Things) HandleEdit(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	row := storage.Row{
-		Metadata: storage.Metadata{
-			Namespace: chi.URLParam(req, "namespace"),
-			Kind:      chi.URLParam(req, "kind"),
-			ID:        id,
-		},
+	row, err := t.storage.Find(req.Context(), chi.URLParam(req, "namespace"), id)
+	if err == nil && row.Kind != chi.URLParam(req, "kind") {
+		err = storage.ErrNotFound
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
 
-		Summary: req.FormValue("summary"),
+	// only change what was sent, e.g. checking a task only sends the bool
+	row.Tags = nil
+	if req.Form.Has("summary") {
+		row.Summary = req.FormValue("summary")
 	}
 
-	if req.FormValue("content") != "" {
-		row.Content.Valid = true
+	if req.Form.Has("content") {
+		row.Content.Valid = req.FormValue("content") != ""
 		row.Content.String = req.FormValue("content")
 	}
 
@@ -389,17 +557,227 @@ func (t *Things) HandleEdit(w http.ResponseWriter, req *http.Request) {
 		row.Bool.Bool = req.FormValue("bool") == "on"
 	}
 
-	err = t.storage.Update(req.Context(), &row)
+	_, hndl := t.handlers.For(row.Kind)
+	if editor, ok := hndl.(handler.Editor); ok {
+		err := editor.Edit(req.Context(), row, req.Form)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	err = update(req.Context(), t.storage, row)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// htmx swaps in the updated thing, e.g. after snoozing a reminder
+	if req.Header.Get("HX-Request") != "" && hndl != nil {
+		loaded, err := handler.Load(req.Context(), t.storage, hndl, row)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		renderer, err := hndl.Render(req.Context(), loaded[0])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = renderer.Render(req.Context(), w)
+		if err != nil {
+			log.Println(err)
+		}
+		return
+	}
+
 	w.Header().Set("Location", req.URL.Path)
 	w.WriteHeader(http.StatusSeeOther)
 }
 
+// update saves row, and adds the next occurrence of repeating reminders and
+// tasks once they are done.  The next occurrence is recorded as next_id, so
+// that it is only added once, even when done again.
+func update(ctx context.Context, db storage.Storage, row *storage.Row) error {
+	old, err := db.Find(ctx, row.Namespace, row.ID)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := old.Fields["next_id"]; !row.Bool.Bool || old.Bool.Bool || ok {
+		return db.Update(ctx, row)
+	}
+
+	next, err := handler.NextOccurrence(old, handler.Now(ctx))
+	if err != nil {
+		return err
+	}
+	if next == nil {
+		return db.Update(ctx, row)
+	}
+
+	return db.UpdateAndInsert(ctx, row, next, "next_id")
+}
+
+// importRates imports the exchange rates in the file at path.
+func importRates(ctx context.Context, db storage.Storage, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rates, err := handler.ParseRates(f)
+	if err != nil {
+		return err
+	}
+
+	err = db.SetRates(ctx, rates)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("imported %d exchange rates from %s", len(rates), path)
+	return nil
+}
+
+// HandleDelete moves a thing to the trash.
+//
+// htmx requests get an empty response so that the thing can be swapped out,
+// others are redirected to the list of things of that kind.
+func (t *Things) HandleDelete(w http.ResponseWriter, req *http.Request) {
+	namespace := chi.URLParam(req, "namespace")
+	kind := chi.URLParam(req, "kind")
+
+	id, err := strconv.ParseInt(chi.URLParam(req, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = t.storage.Delete(req.Context(), namespace, kind, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if req.Header.Get("HX-Request") == "true" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Location", "/"+url.PathEscape(namespace)+"/"+url.PathEscape(kind))
+	w.WriteHeader(http.StatusSeeOther)
+}
+
+func (t *Things) HandleRestore(w http.ResponseWriter, req *http.Request) {
+	namespace := chi.URLParam(req, "namespace")
+	kind := chi.URLParam(req, "kind")
+
+	id, err := strconv.ParseInt(chi.URLParam(req, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = t.storage.Restore(req.Context(), namespace, kind, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/%s/%s/%d", url.PathEscape(namespace), url.PathEscape(kind), id))
+	w.WriteHeader(http.StatusSeeOther)
+}
+
+func (t *Things) HandleHistory(w http.ResponseWriter, req *http.Request) {
+	row, err := t.storage.Find(req.Context(), chi.URLParam(req, "namespace"), chi.URLParam(req, "id"))
+	if err == nil && row.Kind != chi.URLParam(req, "kind") {
+		err = storage.ErrNotFound
+	}
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	revisions, err := t.storage.History(req.Context(), row.Namespace, row.Kind, row.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	pageWithContent(w, req, "", handler.HistoryRenderer(row, revisions))
+}
+
+// HandleRestoreRevision restores the summary and content of a prior revision,
+// which makes the current version a revision as well.
+func (t *Things) HandleRestoreRevision(w http.ResponseWriter, req *http.Request) {
+	revision, err := strconv.ParseInt(chi.URLParam(req, "revision"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	row, err := t.storage.Find(req.Context(), chi.URLParam(req, "namespace"), chi.URLParam(req, "id"))
+	if err == nil && row.Kind != chi.URLParam(req, "kind") {
+		err = storage.ErrNotFound
+	}
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	revisions, err := t.storage.History(req.Context(), row.Namespace, row.Kind, row.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	idx := slices.IndexFunc(revisions, func(rev storage.Revision) bool { return rev.Revision == revision })
+	if idx == -1 {
+		http.Error(w, fmt.Sprintf("no revision %d", revision), http.StatusNotFound)
+		return
+	}
+
+	row.Summary = revisions[idx].Summary
+	row.Content = revisions[idx].Content
+
+	err = t.storage.Update(req.Context(), row)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/%s/%s/%d", url.PathEscape(row.Namespace), url.PathEscape(row.Kind), row.ID))
+	w.WriteHeader(http.StatusSeeOther)
+}
+
 func (t *Things) HandleFind(w http.ResponseWriter, req *http.Request) {
 	row, err := t.storage.Find(req.Context(), chi.URLParam(req, "namespace"), chi.URLParam(req, "id"))
 	if err != nil {
@@ -415,7 +793,13 @@ func (t *Things) HandleFind(w http.ResponseWriter, req *http.Request) {
 	var kindRenderer handler.Renderer
 	kind, hndl := t.handlers.For(row.Kind)
 	if hndl != nil {
-		kindRenderer, err = hndl.Render(req.Context(), row)
+		loaded, err := handler.Load(req.Context(), t.storage, hndl, row)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		kindRenderer, err = hndl.Render(req.Context(), loaded[0])
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -431,10 +815,23 @@ func (t *Things) HandleFind(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	backlinks, err := handler.Backlinks(req.Context(), t.storage, row)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	broken, err := handler.BrokenLinks(req.Context(), t.storage, row)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	renderer := handler.SequenceRenderer([]handler.Renderer{
 		editRenderer,
 		handler.HTMLRenderer("<em>preview:</em>"),
 		kindRenderer,
+		handler.LinksRenderer(row, backlinks, broken),
 	})
 
 	pageWithContent(w, req, "", renderer)
@@ -506,6 +903,27 @@ func (nm *NamespaceMiddleware) Middleware(next http.Handler) http.Handler {
 	})
 }
 
+// settingsMiddleware sets the settings of the namespace on the request
+// context, see [handler.WithLazySettings].
+type settingsMiddleware struct {
+	storage.Storage
+}
+
+func (sm settingsMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		namespace, ok := req.Context().Value(NamespaceKey).(string)
+		if !ok {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		// loaded when used, e.g. not for api requests that only store things
+		ctx := handler.WithLazySettings(req.Context(), sm.Storage, namespace)
+		ctx = handler.WithLinks(ctx, sm.Storage, namespace)
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
 type tokenMiddleware struct {
 	storage.Storage
 }
@@ -531,6 +949,17 @@ func (s tokenMiddleware) Middleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// scripts can pass the token as a header instead of the cookie
+		if token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer "); ok {
+			if !slices.Contains(tokens, token) {
+				writeJSONError(w, http.StatusUnauthorized, errors.New("invalid token"))
+				return
+			}
+
+			next.ServeHTTP(w, req)
+			return
+		}
+
 		tokenCookie, err := req.Cookie(TokenCookieName)
 		if err != nil && err != http.ErrNoCookie {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -538,6 +967,11 @@ func (s tokenMiddleware) Middleware(next http.Handler) http.Handler {
 		}
 
 		if err == http.ErrNoCookie || !slices.Contains(tokens, tokenCookie.Value) {
+			if strings.HasPrefix(req.URL.Path, "/api/") {
+				writeJSONError(w, http.StatusUnauthorized, errors.New("token required"))
+				return
+			}
+
 			http.Redirect(w, req, "/token?redirect-to="+url.QueryEscape(req.URL.Path), http.StatusSeeOther)
 			return
 		}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/heyLu/lp/go/things/storage"
+)
+
+func TestUpdateRepeating(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.NewDBStorage(ctx, ":memory:")
+	require.NoError(t, err)
+
+	row := &storage.Row{
+		Metadata: storage.Metadata{Namespace: "test", Kind: "task"},
+		Summary:  "water plants",
+		Bool:     sql.NullBool{Valid: true},
+		Time:     sql.NullTime{Time: time.Now(), Valid: true},
+		Fields:   map[string]any{"recur": "every day"},
+	}
+	require.NoError(t, db.Insert(ctx, row))
+
+	tasks := func() int {
+		rows, err := db.Query(ctx, "test", storage.Kind("task"))
+		require.NoError(t, err)
+		defer rows.Close()
+
+		n := 0
+		for rows.Next() {
+			n++
+		}
+		return n
+	}
+
+	// done, undone and done again only adds the next occurrence once
+	for _, done := range []bool{true, false, true} {
+		row.Bool.Bool = done
+		require.NoError(t, update(ctx, db, row))
+		require.Equal(t, 2, tasks())
+	}
+	require.NotNil(t, row.Fields["next_id"])
+
+	// concurrent updates that both saw it undone
+	nextID := row.Fields["next_id"]
+	delete(row.Fields, "next_id")
+	next := &storage.Row{Metadata: storage.Metadata{Namespace: "test", Kind: "task"}, Summary: "water plants"}
+	require.NoError(t, db.UpdateAndInsert(ctx, row, next, "next_id"))
+	require.Equal(t, 2, tasks())
+	require.EqualValues(t, nextID, row.Fields["next_id"])
+}